@@ -0,0 +1,42 @@
+//go:build !unix
+
+package gencfg
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// checkAccess approximates access check using file mode and, for executables, file extension.
+func checkAccess(path string, info os.FileInfo, mode accessMode) error {
+	if mode&accessRead != 0 {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		f.Close()
+	}
+	if mode&accessWrite != 0 && info.Mode().Perm()&0200 == 0 {
+		return errors.New("read only")
+	}
+	if mode&accessExecute != 0 && !info.IsDir() {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".exe", ".com", ".bat", ".cmd":
+		default:
+			return errors.New("not an executable")
+		}
+	}
+	return nil
+}
+
+// checkMode does nothing - permission bits are not meaningful on this platform.
+func checkMode(os.FileInfo, os.FileMode) error {
+	return nil
+}
+
+// checkOwner does nothing - file ownership is not supported on this platform.
+func checkOwner(os.FileInfo, string) error {
+	return nil
+}
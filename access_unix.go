@@ -0,0 +1,44 @@
+//go:build unix
+
+package gencfg
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// checkAccess checks if current process has requested access to the path.
+func checkAccess(path string, _ os.FileInfo, mode accessMode) error {
+	return syscall.Access(path, uint32(mode))
+}
+
+// checkMode fails if path has any permission bits set outside of allowed ones.
+func checkMode(info os.FileInfo, allowed os.FileMode) error {
+	if extra := info.Mode().Perm() &^ allowed; extra != 0 {
+		return fmt.Errorf("permissions %04o are too loose, expected at most %04o", info.Mode().Perm(), allowed)
+	}
+	return nil
+}
+
+// checkOwner fails if path is not owned by the user, which could be specified by name or uid.
+func checkOwner(info os.FileInfo, owner string) error {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fmt.Errorf("unable to get owner")
+	}
+	uid := owner
+	if _, err := strconv.ParseUint(owner, 10, 32); err != nil {
+		u, err := user.Lookup(owner)
+		if err != nil {
+			return err
+		}
+		uid = u.Uid
+	}
+	if actual := strconv.FormatUint(uint64(st.Uid), 10); actual != uid {
+		return fmt.Errorf("owned by uid %s, expected '%s' (uid %s)", actual, owner, uid)
+	}
+	return nil
+}
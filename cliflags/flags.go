@@ -0,0 +1,71 @@
+// Package cliflags exposes configuration structure as urfave/cli command line flags, so only
+// programs which want command line flags depend on the CLI framework.
+package cliflags
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+
+	cli "github.com/urfave/cli/v3"
+
+	"github.com/rupor-github/gencfg"
+)
+
+// FlagsCategory is the help category of command line flags generated from configuration structure.
+const FlagsCategory = "CONFIGURATION"
+
+// Flags derives urfave/cli flags from configuration structure (cfg is a struct or pointer to it).
+// Every field which value could be represented as a string gets flag named after dotted path
+// of its YAML names, for example "--db.user". Booleans are regular boolean flags, slices and maps
+// are expected as comma separated lists and key=value pairs respectively. Fields with flag:"-"
+// tag are skipped, as are slices and maps of structures.
+func Flags(cfg any) ([]cli.Flag, error) {
+	fields, err := gencfg.ValueFields(cfg)
+	if err != nil {
+		return nil, err
+	}
+	flags := make([]cli.Flag, 0, len(fields))
+	for _, f := range fields {
+		usage := fmt.Sprintf("Set %s configuration value (%s)", f.Name, f.Type)
+		if f.Type.Kind() == reflect.Bool {
+			flags = append(flags, &cli.BoolFlag{Name: f.Name, Usage: usage, Category: FlagsCategory})
+			continue
+		}
+		flags = append(flags, &cli.StringFlag{Name: f.Name, Usage: usage, Category: FlagsCategory})
+	}
+	return flags, nil
+}
+
+// ApplyFlags assigns values of flags generated by Flags which were set on command line to cfg
+// (pointer to struct). Command line is the highest precedence configuration layer, so it is
+// supposed to be called after gencfg.Load, and the same options should be passed here as sanitizing
+// and validation are performed again on the result.
+func ApplyFlags(cmd *cli.Command, cfg any, options ...func(*gencfg.LoadOptions)) error {
+	val := reflect.ValueOf(cfg)
+	if val.Kind() != reflect.Ptr || val.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("apply flags expected pointer to struct, got %v", val.Kind())
+	}
+	fields, err := gencfg.ValueFields(cfg)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, f := range fields {
+		if !cmd.IsSet(f.Name) {
+			continue
+		}
+		value := cmd.String(f.Name)
+		if f.Type.Kind() == reflect.Bool {
+			value = strconv.FormatBool(cmd.Bool(f.Name))
+		}
+		if err := f.Set(cfg, value); err != nil {
+			errs = append(errs, fmt.Errorf("unable to apply flag '%s' to '%s': %w", f.Name, f.Path, err))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	return gencfg.Check(cfg, options...)
+}
@@ -0,0 +1,80 @@
+package cliflags
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	cli "github.com/urfave/cli/v3"
+
+	"github.com/rupor-github/gencfg"
+)
+
+type dbConfig struct {
+	User    string        `yaml:"user" validate:"required"`
+	Port    int           `yaml:"port" sanitize:"clamp=1:65535"`
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+type config struct {
+	DataDir  string              `yaml:"data_dir" sanitize:"path_clean"`
+	Name     string              `yaml:"name"`
+	Limit    gencfg.ByteSize     `yaml:"limit"`
+	Enabled  *bool               `yaml:"enabled"`
+	DB       dbConfig            `yaml:"db"`
+	Replicas []dbConfig          `yaml:"replicas"`
+	Shards   map[string]dbConfig `yaml:"shards"`
+	Secret   string              `yaml:"secret" flag:"-"`
+}
+
+func TestFlags(t *testing.T) {
+	flags, err := Flags(config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range flags {
+		names = append(names, f.Names()[0])
+	}
+	expected := "data_dir name limit enabled db.user db.port db.timeout"
+	if strings.Join(names, " ") != expected {
+		t.Fatalf("unexpected flags: %v", names)
+	}
+
+	run := func(args ...string) (*config, error) {
+		cfg := &config{DataDir: "/data", DB: dbConfig{User: "someone", Port: 5432}}
+		flags, err := Flags(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var applyErr error
+		cmd := &cli.Command{
+			Name:  "test",
+			Flags: flags,
+			Action: func(ctx context.Context, cmd *cli.Command) error {
+				applyErr = ApplyFlags(cmd, cfg)
+				return nil
+			},
+		}
+		if err := cmd.Run(context.Background(), append([]string{"test"}, args...)); err != nil {
+			t.Fatal(err)
+		}
+		return cfg, applyErr
+	}
+
+	cfg, err := run("--db.user=other", "--db.timeout", "5s", "--enabled", "--limit=2KiB", "--db.port=70000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.DB != (dbConfig{User: "other", Port: 65535, Timeout: 5 * time.Second}) || cfg.Limit != 2*gencfg.KiB || cfg.Enabled == nil || !*cfg.Enabled {
+		t.Fatalf("unexpected values: %+v", cfg)
+	}
+	if cfg.DataDir != "/data" {
+		t.Fatalf("flag which was not set changed value: %+v", cfg)
+	}
+
+	if _, err := run("--db.port=many"); err == nil || !strings.Contains(err.Error(), "'db.port' to 'DB.Port'") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
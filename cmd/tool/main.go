@@ -22,9 +22,10 @@ const errorCode = 1
 func main() {
 
 	app := &cli.Command{
-		Name:    misc.AppName,
-		Usage:   "generate configuration file from template",
-		Version: misc.GetVersion() + " (" + runtime.Version() + ")",
+		Name:      misc.AppName,
+		Usage:     "generate configuration file from template",
+		ArgsUsage: "TEMPLATE [DESTINATION]",
+		Version:   misc.GetVersion() + " (" + runtime.Version() + ")",
 		Flags: []cli.Flag{
 			&cli.StringFlag{
 				Name:    "project-dir",
@@ -36,6 +37,22 @@ func main() {
 				Aliases: []string{"l"},
 				Usage:   "Name of the field(s) not to be treated as template",
 			},
+			&cli.StringSliceFlag{
+				Name:    "include-dir",
+				Aliases: []string{"I"},
+				Usage:   "Directory to look up included partials in after project directory",
+			},
+			&cli.IntFlag{
+				Name:    "indent",
+				Aliases: []string{"i"},
+				Value:   4,
+				Usage:   "Number of spaces used for indentation of generated configuration",
+			},
+			&cli.BoolFlag{
+				Name:    "whole-file",
+				Aliases: []string{"w"},
+				Usage:   "Expand the entire template before processing individual fields",
+			},
 		},
 		Action: func(ctx context.Context, cmd *cli.Command) error {
 
@@ -57,28 +74,52 @@ func main() {
 
 			options := make([]func(*gencfg.ProcessingOptions), 0, 16)
 			options = append(options, gencfg.WithRootDir(cmd.String("project-dir")))
+			options = append(options, gencfg.WithIndent(cmd.Int("indent")))
 			for _, literal := range cmd.StringSlice("literal") {
 				options = append(options, gencfg.WithDoNotExpandField(literal))
 			}
-
-			cnf, err := gencfg.Process(tmpl, options...)
-			if err != nil {
-				return cli.Exit(fmt.Errorf("unable to generate configuration: %w", err), errorCode)
+			if cmd.Bool("whole-file") {
+				options = append(options, gencfg.WithFileTemplate())
 			}
-			cnfFile := os.Stdout
-			cnfPath := cmd.Args().Get(1)
-			if len(cnfPath) != 0 {
-				cnfFile, err = os.Create(cnfPath)
+			for _, dir := range cmd.StringSlice("include-dir") {
+				dir, err := filepath.Abs(dir)
 				if err != nil {
-					return cli.Exit(fmt.Errorf("unable to create output file: %w", err), errorCode)
+					return cli.Exit(fmt.Errorf("normalizing include directory failed: %w", err), errorCode)
 				}
-				defer cnfFile.Close()
+				options = append(options, gencfg.WithIncludeDirs(dir))
 			}
-			_, err = io.Copy(cnfFile, bytes.NewBuffer(cnf))
+
+			cnf, err := gencfg.Process(tmpl, options...)
 			if err != nil {
-				return cli.Exit(fmt.Errorf("unable to write output file: %w", err), errorCode)
+				return cli.Exit(fmt.Errorf("unable to generate configuration: %w", err), errorCode)
 			}
-			return nil
+			return writeOutput(cmd.Args().Get(1), cnf)
+		},
+		Commands: []*cli.Command{
+			{
+				Name:      "skeleton",
+				Usage:     "generate configuration template skeleton from Go configuration structure",
+				ArgsUsage: "TYPE [DESTINATION]",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "package",
+						Aliases: []string{"p"},
+						Value:   ".",
+						Usage:   "Directory of Go package where configuration structure is defined",
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					typeName := cmd.Args().Get(0)
+					if len(typeName) == 0 {
+						return cli.Exit(errors.New("no configuration structure type has been specified"), errorCode)
+					}
+					skeleton, err := gencfg.SkeletonFromPackage(cmd.String("package"), typeName)
+					if err != nil {
+						return cli.Exit(fmt.Errorf("unable to generate skeleton: %w", err), errorCode)
+					}
+					return writeOutput(cmd.Args().Get(1), skeleton)
+				},
+			},
 		},
 	}
 
@@ -86,3 +127,22 @@ func main() {
 		log.Fatal(err)
 	}
 }
+
+// writeOutput writes data to the file or to stdout when path is empty.
+func writeOutput(path string, data []byte) error {
+	var err error
+
+	out := os.Stdout
+	if len(path) != 0 {
+		out, err = os.Create(path)
+		if err != nil {
+			return cli.Exit(fmt.Errorf("unable to create output file: %w", err), errorCode)
+		}
+		defer out.Close()
+	}
+	_, err = io.Copy(out, bytes.NewBuffer(data))
+	if err != nil {
+		return cli.Exit(fmt.Errorf("unable to write output file: %w", err), errorCode)
+	}
+	return nil
+}
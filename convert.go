@@ -0,0 +1,131 @@
+package gencfg
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	durationType        = reflect.TypeFor[time.Duration]()
+	textUnmarshalerType = reflect.TypeFor[encoding.TextUnmarshaler]()
+)
+
+// setFromString parses string representation of the value according to the type of v and assigns it.
+// Types implementing encoding.TextUnmarshaler (ByteSize for example) are parsed by their own code,
+// time.Duration is expected in time.ParseDuration format. Slices and arrays are expected as
+// comma separated lists of elements and maps as comma separated lists of key=value pairs.
+func setFromString(v reflect.Value, s string) error {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return setFromString(v.Elem(), s)
+	}
+	if reflect.PointerTo(v.Type()).Implements(textUnmarshalerType) && v.CanAddr() {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 0, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u, err := strconv.ParseUint(s, 0, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		items := splitList(s)
+		slice := reflect.MakeSlice(v.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := setFromString(slice.Index(i), item); err != nil {
+				return fmt.Errorf("bad element %d: %w", i, err)
+			}
+		}
+		v.Set(slice)
+	case reflect.Array:
+		items := splitList(s)
+		if len(items) > v.Len() {
+			return fmt.Errorf("too many elements %d, expected at most %d", len(items), v.Len())
+		}
+		v.SetZero()
+		for i, item := range items {
+			if err := setFromString(v.Index(i), item); err != nil {
+				return fmt.Errorf("bad element %d: %w", i, err)
+			}
+		}
+	case reflect.Map:
+		items := splitList(s)
+		m := reflect.MakeMapWithSize(v.Type(), len(items))
+		for _, item := range items {
+			k, val, ok := strings.Cut(item, "=")
+			if !ok {
+				return fmt.Errorf("bad map entry '%s', expected key=value", item)
+			}
+			key := reflect.New(v.Type().Key()).Elem()
+			if err := setFromString(key, strings.TrimSpace(k)); err != nil {
+				return fmt.Errorf("bad key '%s': %w", k, err)
+			}
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := setFromString(elem, strings.TrimSpace(val)); err != nil {
+				return fmt.Errorf("bad value for key '%s': %w", k, err)
+			}
+			m.SetMapIndex(key, elem)
+		}
+		v.Set(m)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// parseAs parses string representation of the value of the same type as v without changing v.
+func parseAs(v reflect.Value, s string) (reflect.Value, error) {
+	parsed := reflect.New(v.Type()).Elem()
+	if err := setFromString(parsed, s); err != nil {
+		return reflect.Value{}, err
+	}
+	return parsed, nil
+}
+
+// splitList splits comma separated list trimming spaces around elements, empty string is an empty list.
+func splitList(s string) []string {
+	if len(strings.TrimSpace(s)) == 0 {
+		return nil
+	}
+	items := strings.Split(s, ",")
+	for i := range items {
+		items[i] = strings.TrimSpace(items[i])
+	}
+	return items
+}
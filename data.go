@@ -0,0 +1,69 @@
+package gencfg
+
+import (
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// toYaml implements "toYaml" template function, it marks expansion as producing structured data.
+func (exp *expansion) toYaml(v any) (string, error) {
+	exp.structured = true
+	out, err := yaml.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(out), "\n"), nil
+}
+
+// fromYaml implements "fromYaml" template function.
+func fromYaml(s string) (any, error) {
+	var v any
+	if err := yaml.Unmarshal([]byte(s), &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// readFile implements "readFile" template function, relative paths are resolved against
+// project directory or file system set with WithFS.
+func (exp *expansion) readFile(name string) (string, error) {
+	_, data, err := exp.opts.readFile(name)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// readYaml implements "readYaml" template function, it reads and decodes YAML (or JSON) file.
+func (exp *expansion) readYaml(name string) (any, error) {
+	_, data, err := exp.opts.readFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return fromYaml(string(data))
+}
+
+// glob implements "glob" template function. Relative patterns are matched against project directory
+// or file system set with WithFS and matches are relative too, so they could be passed to readFile.
+func (exp *expansion) glob(pattern string) ([]string, error) {
+	switch {
+	case filepath.IsAbs(pattern):
+		return filepath.Glob(pattern)
+	case exp.opts.fsys != nil:
+		return fs.Glob(exp.opts.fsys, path.Clean(filepath.ToSlash(pattern)))
+	}
+	matches, err := filepath.Glob(filepath.Join(exp.opts.rootDir, pattern))
+	if err != nil {
+		return nil, err
+	}
+	for i, match := range matches {
+		if matches[i], err = filepath.Rel(exp.opts.rootDir, match); err != nil {
+			return nil, err
+		}
+	}
+	return matches, nil
+}
@@ -0,0 +1,257 @@
+package gencfg
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// ApplyDefaults assigns values from "default" struct tags to the fields which have zero values,
+// so structures could be used with sane defaults without configuration template (in tests or
+// by library consumers). Tag value is parsed according to the field type and could be a template
+// expanded with the same variables and functions as configuration template:
+//
+//	DataDir string        `yaml:"data_dir" default:"{{ joinPath .ProjectDir \"data\" }}"`
+//	Timeout time.Duration `yaml:"timeout" default:"30s"`
+//
+// Defaults are applied to nested structures, including ones in slices, arrays and maps.
+// Options are the same as for Process - for example WithRootDir sets .ProjectDir.
+func ApplyDefaults(data any, options ...func(*ProcessingOptions)) error {
+	val := reflect.ValueOf(data)
+	if val.Kind() != reflect.Ptr || val.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("apply defaults expected pointer to struct, got %v", val.Kind())
+	}
+	opts, err := newProcessingOptions(options)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	applyDefaults(val.Elem(), "", opts, &errs)
+	return errors.Join(errs...)
+}
+
+func applyDefaults(val reflect.Value, path string, opts *ProcessingOptions, errs *[]error) {
+	switch val.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if !val.IsNil() {
+			applyDefaults(val.Elem(), path, opts, errs)
+		}
+	case reflect.Struct:
+		for i := 0; i < val.NumField(); i++ {
+			field := val.Field(i)
+			fieldType := val.Type().Field(i)
+			if !fieldType.IsExported() && !fieldType.Anonymous {
+				continue // skip unexported fields
+			}
+			fpath := path
+			if !fieldType.Anonymous {
+				fpath = fieldPath(path, fieldType.Name)
+			}
+			if tag, ok := fieldType.Tag.Lookup("default"); ok && fieldType.IsExported() && field.IsZero() {
+				if err := applyDefault(field, yamlFieldOf(fieldType).name, tag, opts); err != nil {
+					*errs = append(*errs, fmt.Errorf("unable to apply default to '%s': %w", fpath, err))
+					continue
+				}
+			}
+			if field.CanSet() || fieldType.Anonymous {
+				applyDefaults(field, fpath, opts, errs)
+			}
+		}
+	case reflect.Array, reflect.Slice:
+		for j := 0; j < val.Len(); j++ {
+			applyDefaults(val.Index(j), fmt.Sprintf("%s[%d]", path, j), opts, errs)
+		}
+	case reflect.Map:
+		iter := val.MapRange()
+		for iter.Next() {
+			key, value := iter.Key(), iter.Value()
+			if value.Kind() == reflect.Pointer {
+				applyDefaults(value, keyPath(path, key), opts, errs)
+				continue
+			}
+			if value.Kind() != reflect.Struct {
+				continue
+			}
+			// map values are not addressable
+			tempValue := reflect.New(value.Type()).Elem()
+			tempValue.Set(value)
+			applyDefaults(tempValue, keyPath(path, key), opts, errs)
+			val.SetMapIndex(key, tempValue)
+		}
+	}
+}
+
+// applyDefault expands default value if it is a template and assigns it to the field.
+func applyDefault(field reflect.Value, name, value string, opts *ProcessingOptions) error {
+	if possiblyTemplate.MatchString(value) {
+		var err error
+		if value, err = expandField(name, value, opts); err != nil {
+			return err
+		}
+	}
+	return setFromString(field, value)
+}
+
+// decodeWithDefaults decodes YAML data into cfg (pointer to structure with defaults already applied),
+// so that structures allocated by decoding get defaults as well. Defaults are only applied to
+// fields which keys are not present in the data, so explicit zero values are kept.
+func decodeWithDefaults(data []byte, cfg any, opts *ProcessingOptions) error {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	val := reflect.ValueOf(cfg).Elem()
+	var errs []error
+	// decoder reuses existing pointers, but replaces elements of slices, arrays and maps
+	prepareDefaults(&doc, val, "", opts, &errs)
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	if err := decode(data, cfg); err != nil {
+		return err
+	}
+	completeDefaults(&doc, val, "", false, opts, &errs)
+	return errors.Join(errs...)
+}
+
+// valueNode returns node with the actual value, resolving documents and aliases.
+func valueNode(node *yaml.Node) *yaml.Node {
+	for node != nil {
+		switch node.Kind {
+		case yaml.DocumentNode:
+			if len(node.Content) == 0 {
+				return nil
+			}
+			node = node.Content[0]
+		case yaml.AliasNode:
+			node = node.Alias
+		default:
+			return node
+		}
+	}
+	return nil
+}
+
+// mappingValue returns value of the key in mapping node or nil if key is not present.
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if k := valueNode(node.Content[i]); k != nil && k.Kind == yaml.ScalarNode && k.Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// prepareDefaults allocates nil structure pointers which are about to be decoded from
+// the node and applies defaults to them.
+func prepareDefaults(node *yaml.Node, val reflect.Value, path string, opts *ProcessingOptions, errs *[]error) {
+	node = valueNode(node)
+	if node == nil || node.Kind != yaml.MappingNode {
+		return
+	}
+	switch val.Kind() {
+	case reflect.Pointer:
+		if val.IsNil() {
+			if val.Type().Elem().Kind() != reflect.Struct || !val.CanSet() {
+				return
+			}
+			val.Set(reflect.New(val.Type().Elem()))
+			applyDefaults(val, path, opts, errs)
+		}
+		prepareDefaults(node, val.Elem(), path, opts, errs)
+	case reflect.Struct:
+		for i := 0; i < val.NumField(); i++ {
+			fieldType := val.Type().Field(i)
+			yf := yamlFieldOf(fieldType)
+			if yf.skip {
+				continue
+			}
+			if yf.inline {
+				prepareDefaults(node, val.Field(i), path, opts, errs)
+			} else if child := mappingValue(node, yf.name); child != nil {
+				prepareDefaults(child, val.Field(i), fieldPath(path, fieldType.Name), opts, errs)
+			}
+		}
+	}
+}
+
+// completeDefaults applies defaults to the structures created by decoding the node (fresh ones),
+// fields which keys are present in the node are left alone.
+func completeDefaults(node *yaml.Node, val reflect.Value, path string, fresh bool, opts *ProcessingOptions, errs *[]error) {
+	node = valueNode(node)
+	if node == nil {
+		return
+	}
+	switch val.Kind() {
+	case reflect.Pointer:
+		if !val.IsNil() {
+			completeDefaults(node, val.Elem(), path, fresh, opts, errs)
+		}
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			return
+		}
+		for i := 0; i < val.NumField(); i++ {
+			field := val.Field(i)
+			fieldType := val.Type().Field(i)
+			yf := yamlFieldOf(fieldType)
+			if yf.skip {
+				continue
+			}
+			fpath := path
+			if !fieldType.Anonymous {
+				fpath = fieldPath(path, fieldType.Name)
+			}
+			if yf.inline {
+				completeDefaults(node, field, fpath, fresh, opts, errs)
+				continue
+			}
+			if child := mappingValue(node, yf.name); child != nil {
+				completeDefaults(child, field, fpath, fresh, opts, errs)
+				continue
+			}
+			if !fresh {
+				continue
+			}
+			if tag, ok := fieldType.Tag.Lookup("default"); ok && field.IsZero() {
+				if err := applyDefault(field, yf.name, tag, opts); err != nil {
+					*errs = append(*errs, fmt.Errorf("unable to apply default to '%s': %w", fpath, err))
+					continue
+				}
+			}
+			applyDefaults(field, fpath, opts, errs)
+		}
+	case reflect.Array, reflect.Slice:
+		if node.Kind != yaml.SequenceNode {
+			return
+		}
+		for j := 0; j < val.Len() && j < len(node.Content); j++ {
+			completeDefaults(node.Content[j], val.Index(j), fmt.Sprintf("%s[%d]", path, j), true, opts, errs)
+		}
+	case reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			return
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := reflect.New(val.Type().Key())
+			if err := node.Content[i].Decode(key.Interface()); err != nil {
+				continue
+			}
+			value := val.MapIndex(key.Elem())
+			if !value.IsValid() {
+				continue
+			}
+			if value.Kind() == reflect.Pointer {
+				completeDefaults(node.Content[i+1], value, keyPath(path, key.Elem()), true, opts, errs)
+				continue
+			}
+			// map values are not addressable
+			tempValue := reflect.New(value.Type()).Elem()
+			tempValue.Set(value)
+			completeDefaults(node.Content[i+1], tempValue, keyPath(path, key.Elem()), true, opts, errs)
+			val.SetMapIndex(key.Elem(), tempValue)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package gencfg
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// Structural directives are YAML tags on mapping keys. In mappings the value (which must be
+// a mapping itself) is spliced into the parent, in sequences the directive is a single key
+// mapping item and the value (or items of the value if it is a sequence) replaces it:
+//
+//	server:
+//	    !if '{{ .Testing }}':
+//	        debug: true
+//	    !each '{{ list "eu" "us" | toJson }}':
+//	        '{{ .Item }}': '{{ .Index }}'
+//	listeners:
+//	    - !each ports:
+//	        port: '{{ .Item }}'
+const (
+	// tagIf keeps the value when condition is true and removes it otherwise
+	tagIf = "!if"
+	// tagEach replicates the value for every item of the list
+	tagEach = "!each"
+)
+
+// resolveDirectives replaces structural directives among the children of the node.
+func (gctx *generationContext) resolveDirectives(node *yaml.Node) error {
+	step := 1
+	if node.Kind == yaml.MappingNode {
+		step = 2
+	}
+	for i := 0; i+step <= len(node.Content); {
+		var key, value *yaml.Node
+		comments := ""
+		if node.Kind == yaml.MappingNode {
+			key, value = node.Content[i], node.Content[i+1]
+		} else if item := node.Content[i]; item.Kind == yaml.MappingNode && len(item.Content) == 2 {
+			key, value = item.Content[0], item.Content[1]
+			comments = item.HeadComment
+		}
+		if key == nil || key.Kind != yaml.ScalarNode || (key.Tag != tagIf && key.Tag != tagEach) {
+			i += step
+			continue
+		}
+
+		var (
+			replacement []*yaml.Node
+			err         error
+		)
+		if key.Tag == tagIf {
+			replacement, err = gctx.resolveIf(node.Kind, key, value)
+		} else {
+			replacement, err = gctx.resolveEach(node.Kind, value, key)
+		}
+		if err == nil && node.Kind == yaml.MappingNode {
+			if dup, ok := duplicateKey(node.Content, i, replacement); ok {
+				err = fmt.Errorf("duplicate key '%s'", dup)
+			}
+		}
+		if err != nil {
+			return templateError(fmt.Errorf("%s '%s': %w", key.Tag, key.Value, err), gctx.lines, key.Line)
+		}
+		// comments of the directive describe the section, keep them with its first node
+		if len(replacement) > 0 {
+			comments = joinComments(comments, joinComments(key.HeadComment, key.LineComment))
+			replacement[0].HeadComment = joinComments(comments, replacement[0].HeadComment)
+		}
+		node.Content = slices.Replace(node.Content, i, i+step, replacement...)
+		// replicated subtrees are fully processed, while value of !if may have directives of its own
+		if key.Tag == tagEach {
+			i += len(replacement)
+		}
+	}
+	return nil
+}
+
+// expandDirective expands argument of the directive if it is a template.
+func (gctx *generationContext) expandDirective(key *yaml.Node) (string, error) {
+	if !gctx.couldBeTemplate(key.Value) {
+		return key.Value, nil
+	}
+	return (&expansion{opts: gctx.opts}).expand(gctx.name, key.Value, gctx.each)
+}
+
+func (gctx *generationContext) resolveIf(kind yaml.Kind, key, value *yaml.Node) ([]*yaml.Node, error) {
+	cond, err := gctx.expandDirective(key)
+	if err != nil {
+		return nil, err
+	}
+	keep := false
+	if cond = strings.TrimSpace(cond); len(cond) > 0 {
+		if keep, err = strconv.ParseBool(cond); err != nil {
+			return nil, fmt.Errorf("condition must be boolean, got '%s'", cond)
+		}
+	}
+	if !keep {
+		return nil, nil
+	}
+	if kind == yaml.MappingNode {
+		if value.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("value in mapping must be a mapping")
+		}
+		return value.Content, nil
+	}
+	if value.Kind == yaml.SequenceNode {
+		return value.Content, nil
+	}
+	return []*yaml.Node{value}, nil
+}
+
+// eachItems returns list to iterate over. Directive argument is either name of the argument with comma
+// separated list or a template which expands to YAML sequence or comma separated list.
+func (gctx *generationContext) eachItems(key *yaml.Node) ([]any, error) {
+	var list string
+	if gctx.couldBeTemplate(key.Value) {
+		expanded, err := gctx.expandDirective(key)
+		if err != nil {
+			return nil, err
+		}
+		var node yaml.Node
+		if err := yaml.Unmarshal([]byte(expanded), &node); err != nil {
+			return nil, err
+		}
+		if node.Kind == yaml.DocumentNode && len(node.Content) > 0 && node.Content[0].Kind == yaml.SequenceNode {
+			var items []any
+			if err := node.Content[0].Decode(&items); err != nil {
+				return nil, err
+			}
+			return items, nil
+		}
+		list = expanded
+	} else {
+		arg, ok := gctx.opts.args[key.Value]
+		if !ok {
+			return nil, fmt.Errorf("unknown argument '%s'", key.Value)
+		}
+		list = arg
+	}
+	var items []any
+	for _, item := range splitList(list) {
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func (gctx *generationContext) resolveEach(kind yaml.Kind, value, key *yaml.Node) ([]*yaml.Node, error) {
+	items, err := gctx.eachItems(key)
+	if err != nil {
+		return nil, err
+	}
+	if kind == yaml.MappingNode && value.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("value in mapping must be a mapping")
+	}
+
+	name, each := gctx.name, gctx.each
+	defer func() { gctx.name, gctx.each = name, each }()
+
+	var replacement []*yaml.Node
+	for i, item := range items {
+		clone := cloneNode(value)
+		// process copy of the subtree as a value of the field directive belongs to
+		wrapper := &yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{
+			{Kind: yaml.ScalarNode, Tag: "!!str", Value: name}, clone,
+		}}
+		gctx.name, gctx.each = name, &eachItem{value: item, index: i}
+		if err := gctx.walk(clone, wrapper, 1); err != nil {
+			return nil, err
+		}
+		if clone.Kind == yaml.MappingNode && kind == yaml.MappingNode || clone.Kind == yaml.SequenceNode && kind == yaml.SequenceNode {
+			replacement = append(replacement, clone.Content...)
+		} else {
+			replacement = append(replacement, clone)
+		}
+	}
+	if gctx.done == nil {
+		gctx.done = make(map[*yaml.Node]bool)
+	}
+	for _, node := range replacement {
+		gctx.done[node] = true
+	}
+	return replacement, nil
+}
+
+// duplicateKey returns the first key of mapping items spliced by directive which is repeated or
+// already present in the parent mapping, directive being replaced is at index i of the parent content.
+func duplicateKey(parent []*yaml.Node, i int, replacement []*yaml.Node) (string, bool) {
+	seen := make(map[string]bool)
+	for j := 0; j+1 < len(parent); j += 2 {
+		if key := parent[j]; j != i && key.Kind == yaml.ScalarNode && key.Tag != tagIf && key.Tag != tagEach {
+			seen[key.Value] = true
+		}
+	}
+	for j := 0; j+1 < len(replacement); j += 2 {
+		key := replacement[j]
+		if key.Kind != yaml.ScalarNode {
+			continue
+		}
+		if seen[key.Value] {
+			return key.Value, true
+		}
+		seen[key.Value] = true
+	}
+	return "", false
+}
+
+// cloneNode makes a deep copy of the node.
+func cloneNode(node *yaml.Node) *yaml.Node {
+	clone := *node
+	if node.Content != nil {
+		clone.Content = make([]*yaml.Node, len(node.Content))
+		for i, child := range node.Content {
+			clone.Content[i] = cloneNode(child)
+		}
+	}
+	return &clone
+}
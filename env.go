@@ -0,0 +1,117 @@
+package gencfg
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// ApplyEnv assigns values of environment variables to the fields of configuration structure.
+// Variable name is set with "env" struct tag:
+//
+//	User string `yaml:"user" env:"APP_DB_USER"`
+//
+// When prefix is not empty fields without "env" tag are bound automatically - variable name is
+// made of the prefix and path of YAML names of the field, upper cased and joined with '_'
+// (APP_DB_USER for prefix "APP" and field "user" in "db" section). Tag env:"-" excludes field.
+// Only fields which could be parsed from string are bound automatically, nested structures
+// are processed field by field.
+//
+// Values are parsed according to field type: numbers, booleans, durations, types implementing
+// encoding.TextUnmarshaler, comma separated lists for slices and key=value lists for maps.
+// Only variables which are set are applied, so it is normally done after decoding configuration
+// files and before Sanitize and Validate.
+func ApplyEnv(data any, prefix string) error {
+	val := reflect.ValueOf(data)
+	if val.Kind() != reflect.Ptr || val.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("apply env expected pointer to struct, got %v", val.Kind())
+	}
+	var errs []error
+	applyEnv(val.Elem(), "", strings.ToUpper(prefix), &errs)
+	return errors.Join(errs...)
+}
+
+// envName makes environment variable name out of prefix and YAML name of the field.
+func envName(prefix, name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' {
+			return r - 'a' + 'A'
+		}
+		if r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, name)
+	if len(prefix) == 0 {
+		return name
+	}
+	return prefix + "_" + name
+}
+
+// applyEnv processes fields of the structure, prefix is empty when automatic binding is off.
+// It reports if anything has been assigned.
+func applyEnv(element reflect.Value, path, prefix string, errs *[]error) bool {
+	changed := false
+	for i := 0; i < element.NumField(); i++ {
+		field := element.Field(i)
+		fieldType := element.Type().Field(i)
+		yf := yamlFieldOf(fieldType)
+		if yf.skip {
+			continue
+		}
+		fpath, fprefix := path, prefix
+		if !yf.inline {
+			fpath = fieldPath(path, fieldType.Name)
+			if len(prefix) > 0 {
+				fprefix = envName(prefix, yf.name)
+			}
+		}
+
+		t := fieldType.Type
+		if t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+
+		name, tagged := fieldType.Tag.Lookup("env")
+		if name == "-" {
+			continue
+		}
+		// only values which could be parsed from string are bound automatically
+		if !tagged && len(prefix) > 0 && !yf.inline && isScalar(t) {
+			name = fprefix
+		}
+		if len(name) > 0 {
+			if value, ok := os.LookupEnv(name); ok {
+				if err := setFromString(field, value); err != nil {
+					*errs = append(*errs, fmt.Errorf("unable to apply environment variable '%s' to '%s': %w", name, fpath, err))
+				}
+				changed = true
+				continue
+			}
+		}
+
+		// nested structures
+		if t.Kind() != reflect.Struct || reflect.PointerTo(t).Implements(textUnmarshalerType) {
+			continue
+		}
+		if field.Kind() == reflect.Struct {
+			changed = applyEnv(field, fpath, fprefix, errs) || changed
+			continue
+		}
+		if !field.CanSet() {
+			continue
+		}
+		// allocate nil structure pointer only when some of its fields are set
+		target := field
+		if field.IsNil() {
+			target = reflect.New(t)
+		}
+		if applyEnv(target.Elem(), fpath, fprefix, errs) {
+			field.Set(target)
+			changed = true
+		}
+	}
+	return changed
+}
@@ -0,0 +1,162 @@
+package gencfg
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// yamlField describes how structure field is represented in YAML by gopkg.in/yaml.v3.
+type yamlField struct {
+	// name of the field in YAML document
+	name string
+	// inline is set when fields of the structure are inlined into the parent
+	inline bool
+	// skip is set when field is not present in YAML documents
+	skip bool
+}
+
+// yamlFieldOf returns YAML representation of the structure field using the same rules as yaml.v3.
+func yamlFieldOf(field reflect.StructField) yamlField {
+	if !field.IsExported() && !field.Anonymous {
+		return yamlField{skip: true}
+	}
+	tag := field.Tag.Get("yaml")
+	if tag == "-" {
+		return yamlField{skip: true}
+	}
+	name, flags, _ := strings.Cut(tag, ",")
+	yf := yamlField{name: name}
+	for _, flag := range strings.Split(flags, ",") {
+		if flag == "inline" {
+			yf.inline = true
+		}
+	}
+	if len(yf.name) == 0 {
+		yf.name = strings.ToLower(field.Name)
+	}
+	if !field.IsExported() && !yf.inline {
+		yf.skip = true
+	}
+	return yf
+}
+
+// ValueField describes configuration field which value could be set from a single string,
+// for example from command line flag.
+type ValueField struct {
+	// Name is dotted path of YAML names of the field, for example "db.user"
+	Name string
+	// Path is the path of the field, for example "DB.User"
+	Path string
+	// Type of the field value, pointer is dereferenced
+	Type reflect.Type
+
+	owner reflect.Type // configuration structure field belongs to
+	index []int
+}
+
+// ValueFields lists fields of configuration structure (cfg is a struct or pointer to it) which values
+// could be represented as a string: scalars, types implementing encoding.TextUnmarshaler, slices
+// and maps of them. Fields of nested structures are listed too. Fields with flag:"-" tag are skipped.
+func ValueFields(cfg any) ([]ValueField, error) {
+	t := reflect.TypeOf(cfg)
+	if t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("value fields expected struct or pointer to struct, got %v", t)
+	}
+	var fields []ValueField
+	collectValueFields(t, "", "", nil, map[reflect.Type]bool{}, &fields)
+	for i := range fields {
+		fields[i].owner = t
+	}
+	return fields, nil
+}
+
+// Set parses value according to the field type (the same way as environment variables are parsed)
+// and assigns it to the field of cfg (pointer to struct), nil pointers on the way are allocated.
+func (f ValueField) Set(cfg any, value string) error {
+	val := reflect.ValueOf(cfg)
+	if val.Kind() != reflect.Ptr || val.Elem().Type() != f.owner {
+		return fmt.Errorf("set field '%s' expected pointer to %v, got %v", f.Path, f.owner, val.Type())
+	}
+	return setFromString(fieldByIndex(val.Elem(), f.index), value)
+}
+
+func collectValueFields(t reflect.Type, name, path string, index []int, seen map[reflect.Type]bool, fields *[]ValueField) {
+	if seen[t] {
+		// recursive types cannot be flattened
+		return
+	}
+	seen[t] = true
+	defer delete(seen, t)
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		yf := yamlFieldOf(sf)
+		if yf.skip || sf.Tag.Get("flag") == "-" {
+			continue
+		}
+		fname, fpath := name, path
+		if !yf.inline {
+			fname = yf.name
+			if len(name) > 0 {
+				fname = name + "." + yf.name
+			}
+			fpath = fieldPath(path, sf.Name)
+		}
+		findex := append(append([]int(nil), index...), i)
+
+		ft := sf.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if isScalar(ft) {
+			*fields = append(*fields, ValueField{Name: fname, Path: fpath, Type: ft, index: findex})
+		} else if ft.Kind() == reflect.Struct {
+			collectValueFields(ft, fname, fpath, findex, seen, fields)
+		}
+	}
+}
+
+// isScalar reports if value of type t could be parsed from a single string (flag value or
+// environment variable) by setFromString.
+func isScalar(t reflect.Type) bool {
+	if reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return true
+	case reflect.Slice, reflect.Array:
+		return isScalar(t.Elem())
+	case reflect.Map:
+		return isScalar(t.Key()) && isScalar(t.Elem())
+	}
+	return false
+}
+
+// fieldByIndex is reflect.Value.FieldByIndex which allocates nil pointers on the way and
+// dereferences the final field.
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for _, i := range index {
+		if v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(i)
+	}
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	return v
+}
@@ -0,0 +1,119 @@
+package gencfg
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// TemplateError is returned when rendered whole file template could not be processed,
+// Line is the approximate line of the template which produced offending output.
+type TemplateError struct {
+	Line int
+	Err  error
+}
+
+func (e *TemplateError) Error() string {
+	return fmt.Sprintf("template line %d: %v", e.Line, e.Err)
+}
+
+func (e *TemplateError) Unwrap() error {
+	return e.Err
+}
+
+// renderFile expands the whole source as a single template. It returns rendered output and
+// mapping of its lines to the lines of the template.
+func renderFile(src []byte, opts *ProcessingOptions) ([]byte, []int, error) {
+	tmpl := template.New("config").Funcs(newFuncMap(&expansion{opts: opts}))
+	if len(opts.fileDelims[0]) > 0 {
+		tmpl = tmpl.Delims(opts.fileDelims[0], opts.fileDelims[1])
+	}
+	tmpl, err := tmpl.Parse(string(src))
+	if err != nil {
+		return nil, nil, err
+	}
+	values, err := newValues("", opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	buf := new(bytes.Buffer)
+	if err := tmpl.Execute(buf, values); err != nil {
+		return nil, nil, err
+	}
+	return buf.Bytes(), alignLines(src, buf.Bytes(), opts.fileDelims[0]), nil
+}
+
+// alignLines maps lines of rendered output to the template lines (both 1 based, index 0 is unused).
+// Template lines without actions are copied to output verbatim, so they are aligned with output
+// using longest common subsequence, and lines in between are attributed to the template lines with
+// actions which produced them. Blank lines are not used for alignment as actions often produce them.
+func alignLines(src, out []byte, left string) []int {
+	if len(left) == 0 {
+		left = "{{"
+	}
+	tmplLines := strings.Split(string(src), "\n")
+	outLines := strings.Split(string(out), "\n")
+
+	var anchors []int
+	for j, line := range tmplLines {
+		if !strings.Contains(line, left) && len(strings.TrimSpace(line)) > 0 {
+			anchors = append(anchors, j)
+		}
+	}
+	n, m := len(outLines), len(anchors)
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for k := m - 1; k >= 0; k-- {
+			if outLines[i] == tmplLines[anchors[k]] {
+				lcs[i][k] = lcs[i+1][k+1] + 1
+			} else {
+				lcs[i][k] = max(lcs[i+1][k], lcs[i][k+1])
+			}
+		}
+	}
+
+	lines := make([]int, n+1)
+	next := 0 // first template line after the last matched one
+	for i, k := 0, 0; i < n; {
+		switch {
+		case k < m && outLines[i] == tmplLines[anchors[k]]:
+			lines[i+1] = anchors[k] + 1
+			next = anchors[k] + 1
+			i, k = i+1, k+1
+		case k < m && lcs[i][k+1] > lcs[i+1][k]:
+			k++
+		default:
+			// produced by action, attribute to the closest template line which is not matched yet
+			lines[i+1] = min(next, len(tmplLines)-1) + 1
+			i++
+		}
+	}
+	return lines
+}
+
+var errorLine = regexp.MustCompile(`line (\d+)`)
+
+// templateError maps line of rendered output error refers to back to template line.
+// Error is returned unchanged when whole file template is not used.
+func templateError(err error, lines []int, line int) error {
+	if lines == nil || err == nil {
+		return err
+	}
+	if line == 0 {
+		m := errorLine.FindStringSubmatch(err.Error())
+		if m == nil {
+			return err
+		}
+		line, _ = strconv.Atoi(m[1])
+	}
+	if line <= 0 || line >= len(lines) {
+		return err
+	}
+	return &TemplateError{Line: lines[line], Err: err}
+}
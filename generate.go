@@ -1,9 +1,15 @@
 package gencfg
 
 import (
+	"bytes"
 	"fmt"
+	"io/fs"
 	"os"
+	"path"
+	"path/filepath"
 	"regexp"
+	"slices"
+	"strings"
 
 	yaml "gopkg.in/yaml.v3"
 )
@@ -13,6 +19,19 @@ type ProcessingOptions struct {
 	rootDir     string
 	args        map[string]string
 	doNotExpand map[string]bool
+	includeDirs []string
+	includeFS   fs.FS
+	fsys        fs.FS
+	tagHandlers map[string]TagHandler
+	readFiles   *[]string
+	lenientDNS  bool
+	// typing of expanded values
+	stringFields      map[string]bool
+	explicitStructure bool
+	indent            int
+	// whole file templating
+	fileTemplate bool
+	fileDelims   [2]string
 }
 
 // WithRootDir sets root directory for template expansion.
@@ -43,9 +62,138 @@ func WithDoNotExpandField(name string) func(*ProcessingOptions) {
 	}
 }
 
+// WithIndent sets number of spaces used for indentation of generated YAML, default is 4.
+func WithIndent(spaces int) func(*ProcessingOptions) {
+	return func(opts *ProcessingOptions) {
+		opts.indent = spaces
+	}
+}
+
+// WithStringField marks field which expanded value must be kept as a string rather than interpreted
+// as YAML, so "yes", "0123" or "null" stay strings. Field is specified with dotted path of the mapping
+// keys, for example "db.password", items of sequences share path of the sequence.
+func WithStringField(path string) func(*ProcessingOptions) {
+	return func(opts *ProcessingOptions) {
+		if opts.stringFields == nil {
+			opts.stringFields = make(map[string]bool)
+		}
+		opts.stringFields[path] = true
+	}
+}
+
+// WithExplicitStructure changes how expanded values are interpreted: they are kept as strings unless
+// template explicitly emits structured data with toJson (and similar functions) or include. Numbers and
+// booleans have to be emitted explicitly too: '{{ freeLocalPort | toJson }}'. Values of custom tags
+// are kept as strings as well.
+func WithExplicitStructure() func(*ProcessingOptions) {
+	return func(opts *ProcessingOptions) {
+		opts.explicitStructure = true
+	}
+}
+
+// WithLenientDNS makes name resolution failures non fatal: .IPv4 and .IPv6 are left empty and
+// lookupHost returns empty list when host could not be resolved.
+func WithLenientDNS() func(*ProcessingOptions) {
+	return func(opts *ProcessingOptions) {
+		opts.lenientDNS = true
+	}
+}
+
+// WithIncludeDirs adds directories where partials for "include" template function are looked up
+// after project directory. Relative directories are resolved against project directory
+// (or file system set with WithFS).
+func WithIncludeDirs(dirs ...string) func(*ProcessingOptions) {
+	return func(opts *ProcessingOptions) {
+		opts.includeDirs = append(opts.includeDirs, dirs...)
+	}
+}
+
+// WithIncludeFS sets file system where partials for "include" template function are looked up
+// when they could not be found in project and include directories, embed.FS for example.
+func WithIncludeFS(fsys fs.FS) func(*ProcessingOptions) {
+	return func(opts *ProcessingOptions) {
+		opts.includeFS = fsys
+	}
+}
+
+// WithFS sets file system representing project directory. When set, relative paths of partials,
+// data and configuration files are resolved in it rather than in project directory on disk, so
+// templates could live in embed.FS or fstest.MapFS. Absolute paths always refer to OS file system.
+func WithFS(fsys fs.FS) func(*ProcessingOptions) {
+	return func(opts *ProcessingOptions) {
+		opts.fsys = fsys
+	}
+}
+
+// WithFileTemplate turns on whole file templating: before parsing YAML the entire source is expanded
+// as a single template with the same variables and functions, so sections could be included conditionally
+// or generated in loops. Result is then processed as usual. Since all actions are executed during the first
+// pass, node level templates have to be escaped ('{{"{{ .Name }}"}}') or different delimiters used for
+// the whole file, see WithFileTemplateDelims.
+func WithFileTemplate() func(*ProcessingOptions) {
+	return func(opts *ProcessingOptions) {
+		opts.fileTemplate = true
+	}
+}
+
+// WithFileTemplateDelims turns on whole file templating with specified action delimiters, for example
+// "[[" and "]]", leaving node level templates intact for the second pass.
+func WithFileTemplateDelims(left, right string) func(*ProcessingOptions) {
+	return func(opts *ProcessingOptions) {
+		opts.fileTemplate = true
+		opts.fileDelims = [2]string{left, right}
+	}
+}
+
+// WithReadFiles makes Process record names of all files read while expanding templates (partials,
+// data files and so on): absolute paths of the files on disk and names of the files in file system
+// set with WithFS.
+func WithReadFiles(files *[]string) func(*ProcessingOptions) {
+	return func(opts *ProcessingOptions) {
+		opts.readFiles = files
+	}
+}
+
+// readFile reads file which relative name is resolved against project directory or file system set with
+// WithFS. It returns location of the file which uniquely identifies it and records it if requested.
+func (opts *ProcessingOptions) readFile(name string) (string, []byte, error) {
+	var (
+		data []byte
+		err  error
+	)
+	switch {
+	case filepath.IsAbs(name):
+		name = filepath.Clean(name)
+		data, err = os.ReadFile(name)
+	case opts.fsys != nil:
+		name = path.Clean(filepath.ToSlash(name))
+		data, err = fs.ReadFile(opts.fsys, name)
+	default:
+		name = filepath.Join(opts.rootDir, name)
+		data, err = os.ReadFile(name)
+	}
+	if err == nil && opts.readFiles != nil && !slices.Contains(*opts.readFiles, name) {
+		*opts.readFiles = append(*opts.readFiles, name)
+	}
+	return name, data, err
+}
+
 type generationContext struct {
 	opts *ProcessingOptions
 	name string
+	// lines maps lines of the rendered whole file template to the template lines
+	lines []int
+	// each is the current item when subtree is replicated with !each
+	each *eachItem
+	// done holds nodes replicated with !each which are already processed
+	done map[*yaml.Node]bool
+	// path holds keys leading to the current node
+	path []string
+}
+
+// isStringField reports if value of the current node must be kept as a string.
+func (gctx *generationContext) isStringField() bool {
+	return gctx.opts.stringFields[strings.Join(gctx.path, ".")]
 }
 
 // optimization - to avoid touching nodes which could not be templates.
@@ -57,17 +205,49 @@ func (gctx *generationContext) couldBeTemplate(field string) bool {
 
 // walk walks the YAML tree and expands fields if necessary
 func (gctx *generationContext) walk(current, parent *yaml.Node, pos int) error {
+	// structural directives are resolved first, so replicated subtrees could be expanded for every item
+	if current.Kind == yaml.MappingNode || current.Kind == yaml.SequenceNode {
+		if err := gctx.resolveDirectives(current); err != nil {
+			return err
+		}
+	}
 	// iterate over all children of the current node before attempting to modify node itself
 	// to avoid potential for loop - we have no idea how node will be expanded
 	for i := 0; i < len(current.Content); i++ {
-		if err := gctx.walk(current.Content[i], current, i%2); err != nil {
+		if gctx.done[current.Content[i]] {
+			continue
+		}
+		// keep track of the path of the mapping values, sequence items share path of the sequence
+		isValue := current.Kind == yaml.MappingNode && i%2 == 1
+		if isValue {
+			gctx.path = append(gctx.path, current.Content[i-1].Value)
+		}
+		err := gctx.walk(current.Content[i], current, i%2)
+		if isValue {
+			gctx.path = gctx.path[:len(gctx.path)-1]
+		}
+		if err != nil {
 			return err
 		}
 	}
+	// Values with custom tags are resolved by tag handlers
+	if parent != nil && (parent.Kind == yaml.SequenceNode || parent.Kind == yaml.MappingNode && pos == 1) {
+		if handler := gctx.opts.lookupTag(current.Tag); handler != nil {
+			return gctx.resolveTag(current, parent, handler)
+		}
+	}
 	// Value of any "terminal" node of a valid type could be "expanded" if necessary
 	if parent != nil && parent.Kind == yaml.MappingNode {
 		// first node in the mapping
 		if pos == 0 {
+			// keys of replicated subtrees could be templates too
+			if gctx.each != nil && current.Tag == "!!str" && gctx.couldBeTemplate(current.Value) {
+				key, err := (&expansion{opts: gctx.opts}).expand(gctx.name, current.Value, gctx.each)
+				if err != nil {
+					return templateError(err, gctx.lines, current.Line)
+				}
+				current.Value = key
+			}
 			// save the name of the field, we may need it for expansion later
 			gctx.name = current.Value
 			return nil
@@ -76,49 +256,141 @@ func (gctx *generationContext) walk(current, parent *yaml.Node, pos int) error {
 		if current.Tag == "!!str" && gctx.couldBeTemplate(current.Value) &&
 			(gctx.opts.doNotExpand == nil || !gctx.opts.doNotExpand[gctx.name]) {
 
-			value, err := expandField(gctx.name, current.Value, gctx.opts)
+			exp := &expansion{opts: gctx.opts}
+			value, err := exp.expand(gctx.name, current.Value, gctx.each)
 			if err != nil {
-				return err
+				return templateError(err, gctx.lines, current.Line)
 			}
-			// Properly interpret expanded value - it may be YAML/JSON fragment
-			var subnode yaml.Node
-			if err := yaml.Unmarshal([]byte(value), &subnode); err != nil {
-				return err
-			}
-			// Unwrap document node
-			if subnode.Kind == yaml.DocumentNode {
-				if len(subnode.Content) >= 1 {
-					subnode = *subnode.Content[0]
-				}
+			keepString := gctx.isStringField() || gctx.opts.explicitStructure && !exp.structured
+			if err := gctx.setValue(current, parent, value, keepString); err != nil {
+				return templateError(err, gctx.lines, current.Line)
 			}
-			// Copy all fields from the expanded node to the current one - replacing node in place
-			current.Alias = subnode.Alias
-			current.Anchor = subnode.Anchor
-			current.Content = subnode.Content
-			current.Kind = subnode.Kind
-			current.Tag = subnode.Tag
-			if subnode.Style != 0 {
-				current.Style = subnode.Style
-			} else {
-				if subnode.Tag == "!!bool" ||
-					subnode.Tag == "!!null" ||
-					subnode.Tag == "!!int" ||
-					subnode.Tag == "!!float" {
-					// to keep results consistent with our existing puppet implementation
-					current.Style = yaml.FlowStyle
-				}
-				// TODO: see if style changes are needed for anything else "!!timestamp" "!!seq" "!!map" "!!binary" "!!merge"
-			}
-			current.Value = subnode.Value
 		}
 	}
 	return nil
 }
 
-// Process generates configuration file from template using nodes names and values.
-func Process(src []byte, options ...func(*ProcessingOptions)) ([]byte, error) {
+// resolveTag replaces node having custom tag with the value returned by tag handler.
+func (gctx *generationContext) resolveTag(current, parent *yaml.Node, handler TagHandler) error {
+	ctx := &TagContext{Name: gctx.name, Tag: current.Tag, opts: gctx.opts, each: gctx.each}
+	value, err := handler(ctx, current)
+	if err != nil {
+		return templateError(fmt.Errorf("%s: %w", ctx.Tag, err), gctx.lines, current.Line)
+	}
+	keepString := ctx.KeepString || gctx.isStringField() || gctx.opts.explicitStructure
+	if err := gctx.setValue(current, parent, value, keepString || ctx.KeepScalar); err != nil {
+		return templateError(err, gctx.lines, current.Line)
+	}
+	// value is never parsed as YAML document, only type of the plain scalar is resolved
+	if !keepString && ctx.KeepScalar && len(value) > 0 {
+		current.Tag = (&yaml.Node{Kind: yaml.ScalarNode, Value: value}).ShortTag()
+	}
+	return nil
+}
+
+// setValue replaces node in place with the value, which is interpreted as YAML/JSON fragment
+// unless keepString is set. Comments of the node are preserved.
+func (gctx *generationContext) setValue(current, parent *yaml.Node, value string, keepString bool) error {
+	// explicit tag of the original node should not be carried over
+	current.Style &^= yaml.TaggedStyle
+	if keepString {
+		current.Kind = yaml.ScalarNode
+		current.Tag = "!!str"
+		current.Value = value
+		current.Content = nil
+		current.Alias = nil
+		return nil
+	}
+
+	// Properly interpret expanded value - it may be YAML/JSON fragment
+	var subnode yaml.Node
+	if err := yaml.Unmarshal([]byte(value), &subnode); err != nil {
+		return err
+	}
+	// Unwrap document node
+	if subnode.Kind == yaml.DocumentNode {
+		if len(subnode.Content) >= 1 {
+			doc := subnode
+			subnode = *subnode.Content[0]
+			subnode.HeadComment = joinComments(doc.HeadComment, subnode.HeadComment)
+			subnode.FootComment = joinComments(subnode.FootComment, doc.FootComment)
+		}
+	}
+	// Empty document is an empty string
+	if subnode.Kind == 0 || subnode.Kind == yaml.DocumentNode {
+		subnode = yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str"}
+	}
+	mergeComments(current, &subnode)
+	// line comment of the value expanded into block collection belongs to the key (or goes
+	// above sequence item), otherwise it ends up after the last line of the collection
+	if subnode.Kind != yaml.ScalarNode && subnode.Style&yaml.FlowStyle == 0 && len(current.LineComment) > 0 {
+		if key := keyOf(parent, current); key != nil && len(key.LineComment) == 0 {
+			key.LineComment = current.LineComment
+		} else {
+			current.HeadComment = joinComments(current.HeadComment, current.LineComment)
+		}
+		current.LineComment = ""
+	}
+	// Copy all fields from the expanded node to the current one - replacing node in place
+	current.Alias = subnode.Alias
+	current.Anchor = subnode.Anchor
+	current.Content = subnode.Content
+	current.Kind = subnode.Kind
+	current.Tag = subnode.Tag
+	if subnode.Style != 0 || subnode.Kind != yaml.ScalarNode {
+		// quoting style of the template makes no sense for collections
+		current.Style = subnode.Style
+	} else {
+		if subnode.Tag == "!!bool" ||
+			subnode.Tag == "!!null" ||
+			subnode.Tag == "!!int" ||
+			subnode.Tag == "!!float" {
+			// to keep results consistent with our existing puppet implementation
+			current.Style = yaml.FlowStyle
+		}
+		// TODO: see if style changes are needed for anything else "!!timestamp" "!!seq" "!!map" "!!binary" "!!merge"
+	}
+	current.Value = subnode.Value
+	return nil
+}
+
+// keyOf returns key node of the value in mapping, nil if parent is not a mapping.
+func keyOf(parent, value *yaml.Node) *yaml.Node {
+	if parent == nil || parent.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 1; i < len(parent.Content); i += 2 {
+		if parent.Content[i] == value {
+			return parent.Content[i-1]
+		}
+	}
+	return nil
+}
+
+// mergeComments keeps comments of the node and adds ones coming with expanded value (from
+// partials for example), comments of the document are attached to the value itself.
+func mergeComments(current, subnode *yaml.Node) {
+	current.HeadComment = joinComments(current.HeadComment, subnode.HeadComment)
+	if len(current.LineComment) == 0 {
+		current.LineComment = subnode.LineComment
+	}
+	current.FootComment = joinComments(subnode.FootComment, current.FootComment)
+}
 
-	opts := &ProcessingOptions{}
+// joinComments joins comment blocks skipping empty ones.
+func joinComments(first, second string) string {
+	if len(first) == 0 {
+		return second
+	}
+	if len(second) == 0 {
+		return first
+	}
+	return first + "\n" + second
+}
+
+// newProcessingOptions applies options and fills in defaults.
+func newProcessingOptions(options []func(*ProcessingOptions)) (*ProcessingOptions, error) {
+	opts := &ProcessingOptions{indent: 4}
 	for _, setOpt := range options {
 		setOpt(opts)
 	}
@@ -130,19 +402,44 @@ func Process(src []byte, options ...func(*ProcessingOptions)) ([]byte, error) {
 		}
 		opts.rootDir = pwd
 	}
+	if opts.indent < 2 || opts.indent > 9 {
+		return nil, fmt.Errorf("indentation must be from 2 to 9 spaces, got %d", opts.indent)
+	}
+	return opts, nil
+}
+
+// Process generates configuration file from template using nodes names and values.
+func Process(src []byte, options ...func(*ProcessingOptions)) ([]byte, error) {
+
+	opts, err := newProcessingOptions(options)
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []int
+	if opts.fileTemplate {
+		if src, lines, err = renderFile(src, opts); err != nil {
+			return nil, err
+		}
+	}
 
 	var tree yaml.Node
 	if err := yaml.Unmarshal(src, &tree); err != nil {
-		return nil, err
+		return nil, templateError(err, lines, 0)
 	}
 
-	if err := (&generationContext{opts: opts}).walk(&tree, nil, 0); err != nil {
+	if err := (&generationContext{opts: opts, lines: lines}).walk(&tree, nil, 0); err != nil {
 		return nil, err
 	}
 
-	output, err := yaml.Marshal(&tree)
-	if err != nil {
+	buf := new(bytes.Buffer)
+	enc := yaml.NewEncoder(buf)
+	enc.SetIndent(opts.indent)
+	if err := enc.Encode(&tree); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
 		return nil, err
 	}
-	return output, nil
+	return buf.Bytes(), nil
 }
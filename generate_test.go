@@ -0,0 +1,603 @@
+package gencfg
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+func TestProcessInclude(t *testing.T) {
+	dir := t.TempDir()
+	partials := filepath.Join(dir, "partials")
+	if err := os.Mkdir(partials, 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		filepath.Join(dir, "db.yaml.tmpl"):            "host: localhost\nname: {{ .Name }}\n",
+		filepath.Join(partials, "logging.yaml.tmpl"):  "level: {{ .Arguments.level }}\nfile: {{ include \"file.yaml.tmpl\" . }}\n",
+		filepath.Join(partials, "file.yaml.tmpl"):     "{{ joinPath .ProjectDir \"app.log\" }}",
+		filepath.Join(partials, "cycle_a.yaml.tmpl"):  "{{ include \"cycle_b.yaml.tmpl\" . }}",
+		filepath.Join(partials, "cycle_b.yaml.tmpl"):  "{{ include \"cycle_a.yaml.tmpl\" . }}",
+		filepath.Join(partials, "override.yaml.tmpl"): "from: disk\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fsys := fstest.MapFS{
+		"tracing.yaml.tmpl":  {Data: []byte("enabled: {{ .Testing }}\n")},
+		"override.yaml.tmpl": {Data: []byte("from: fs\n")},
+	}
+
+	tmpl := []byte(`
+db: '{{ include "db.yaml.tmpl" . }}'
+logging: '{{ include "logging.yaml.tmpl" . }}'
+tracing: '{{ include "tracing.yaml.tmpl" . }}'
+override: '{{ include "override.yaml.tmpl" . }}'
+`)
+	options := []func(*ProcessingOptions){
+		WithRootDir(dir),
+		WithIncludeDirs("partials"),
+		WithIncludeFS(fsys),
+		WithArgument("level", "debug"),
+	}
+	out, err := Process(tmpl, options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cfg struct {
+		DB       struct{ Host, Name string }
+		Logging  struct{ Level, File string }
+		Tracing  struct{ Enabled bool }
+		Override struct{ From string }
+	}
+	if err := decode(out, &cfg); err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	if cfg.DB.Host != "localhost" || cfg.DB.Name != "db" {
+		t.Fatalf("unexpected db section: %+v\n%s", cfg.DB, out)
+	}
+	if cfg.Logging.Level != "debug" || cfg.Logging.File != filepath.Join(dir, "app.log") {
+		t.Fatalf("unexpected logging section: %+v\n%s", cfg.Logging, out)
+	}
+	if !cfg.Tracing.Enabled || cfg.Override.From != "disk" {
+		t.Fatalf("unexpected values: %+v\n%s", cfg, out)
+	}
+
+	_, err = Process([]byte(`a: '{{ include "cycle_a.yaml.tmpl" . }}'`), options...)
+	if err == nil || !strings.Contains(err.Error(), "include cycle detected") {
+		t.Fatalf("expected include cycle, got: %v", err)
+	}
+	_, err = Process([]byte(`a: '{{ include "missing.yaml.tmpl" . }}'`), WithRootDir(dir))
+	if err == nil || !strings.Contains(err.Error(), "partial 'missing.yaml.tmpl' not found") {
+		t.Fatalf("expected missing partial, got: %v", err)
+	}
+}
+
+func TestProcessFileTemplate(t *testing.T) {
+	tmpl := []byte(`name: service
+{{- if eq .Arguments.env "dev" }}
+debug:
+    level: trace
+{{- end }}
+listeners:
+{{- range $i, $port := list 8080 8081 }}
+    - port: {{ $port }}
+      index: {{ $i }}
+{{- end }}
+`)
+	var cfg struct {
+		Name      string
+		Debug     *struct{ Level string }
+		Listeners []struct{ Port, Index int }
+	}
+	out, err := Process(tmpl, WithFileTemplate(), WithArgument("env", "dev"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := decode(out, &cfg); err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	if cfg.Debug == nil || cfg.Debug.Level != "trace" || len(cfg.Listeners) != 2 || cfg.Listeners[1].Port != 8081 {
+		t.Fatalf("unexpected values: %+v\n%s", cfg, out)
+	}
+
+	// node level templates survive first pass with different delimiters
+	out, err = Process([]byte("[[ if .Testing ]]node: '{{ .Name }}'[[ end ]]\n"), WithFileTemplateDelims("[[", "]]"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(string(out)) != "node: 'node'" {
+		t.Fatalf("unexpected output: %s", out)
+	}
+
+	// errors in rendered output are reported against template lines
+	bad := []byte(`a: 1
+{{- range list 1 2 }}
+b: {{ . }}
+{{- end }}
+c: 3
+d: [
+`)
+	_, err = Process(bad, WithFileTemplate())
+	var terr *TemplateError
+	if !errors.As(err, &terr) || terr.Line != 6 {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, err = Process([]byte("a: 1\n\nb: '{{ fail \"boom\" }}'\n"), WithFileTemplateDelims("[[", "]]"))
+	if !errors.As(err, &terr) || terr.Line != 3 {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// blank lines produced by actions are not matched with blank lines of the template
+	blank := "a: 1\n{{ if true }}\nb: 2\n{{ end }}\nc: 3\n\nd: 4\nx: y: z\n"
+	if lines := alignLines([]byte(blank), []byte("a: 1\n\nb: 2\n\nc: 3\n\nd: 4\nx: y: z\n"), ""); !slices.Equal(lines, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}) {
+		t.Fatalf("unexpected line mapping: %v", lines)
+	}
+	_, err = Process([]byte(blank), WithFileTemplate())
+	if !errors.As(err, &terr) || terr.Line != 8 {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestProcessDirectives(t *testing.T) {
+	tmpl := []byte(`
+server:
+    port: 80
+    !if '{{ .Testing }}':
+        debug: true
+        !if '{{ eq .Arguments.env "prod" }}':
+            prod: true
+    !if "false":
+        never: true
+    !each '{{ list "eu" "us" | toJson }}':
+        '{{ .Item }}': '{{ .Index }}'
+listeners:
+    - first
+    - !if '{{ .Testing }}': second
+    - !if '{{ not .Testing }}': never
+    - !each ports:
+        name: '{{ .Name }}-{{ .Index }}'
+        port: '{{ .Item }}'
+    - !each '{{ list (dict "host" "a") (dict "host" "b") | toJson }}':
+        - host: '{{ .Item.host }}'
+`)
+	out, err := Process(tmpl, WithArgument("ports", "8080, 8081"), WithArgument("env", "dev"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cfg struct {
+		Server    map[string]any
+		Listeners []any
+	}
+	if err := decode(out, &cfg); err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	if len(cfg.Server) != 4 || cfg.Server["debug"] != true || cfg.Server["eu"] != 0 || cfg.Server["us"] != 1 {
+		t.Fatalf("unexpected server section: %v\n%s", cfg.Server, out)
+	}
+	expected := `[first second map[name:name-0 port:8080] map[name:name-1 port:8081] map[host:a] map[host:b]]`
+	if fmt.Sprint(cfg.Listeners) != expected {
+		t.Fatalf("unexpected listeners: %v\n%s", cfg.Listeners, out)
+	}
+
+	_, err = Process([]byte("a:\n    !if maybe:\n        b: 1\n"))
+	if err == nil || !strings.Contains(err.Error(), "condition must be boolean") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, err = Process([]byte("a:\n    !each missing:\n        b: 1\n"))
+	if err == nil || !strings.Contains(err.Error(), "unknown argument 'missing'") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// replicated keys must not clash with each other or with keys of the parent mapping
+	regions := WithArgument("regions", "eu,us")
+	_, err = Process([]byte("a:\n    eu: 1\n    !each regions:\n        '{{ .Item }}': 2\n"), regions)
+	if err == nil || !strings.Contains(err.Error(), "!each 'regions': duplicate key 'eu'") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, err = Process([]byte("a:\n    !each regions:\n        same: '{{ .Item }}'\n"), regions)
+	if err == nil || !strings.Contains(err.Error(), "!each 'regions': duplicate key 'same'") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, err = Process([]byte("a: 1\n!if 'true':\n    a: 2\n"))
+	if err == nil || !strings.Contains(err.Error(), "!if 'true': duplicate key 'a'") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestProcessTags(t *testing.T) {
+	t.Setenv("GENCFG_TEST_PORT", "5432")
+	t.Setenv("GENCFG_TEST_FLAG", "true")
+	fsys := fstest.MapFS{
+		"secrets/pass": {Data: []byte("s3cret\n")},
+		"cert.pem":     {Data: []byte("true")},
+	}
+	RegisterTagHandler("!upper", func(ctx *TagContext, node *yaml.Node) (string, error) {
+		params, err := ctx.Params(node)
+		if err != nil {
+			return "", err
+		}
+		return strings.ToUpper(strings.Join(params, " ")), nil
+	})
+	// do not leak test handler into global registry
+	t.Cleanup(func() {
+		tagRegistryGuard.Lock()
+		defer tagRegistryGuard.Unlock()
+		delete(tagRegistry, "!upper")
+	})
+	tmpl := []byte(`
+port: !env GENCFG_TEST_PORT
+flag: !env GENCFG_TEST_FLAG
+user: !env [GENCFG_TEST_MISSING, admin]
+pass: !file secrets/pass
+cert: !base64file cert.pem
+region: !arg region
+zone: !arg [zone, a]
+hosts: [!arg region, !upper [b, c]]
+name: !local x
+`)
+	out, err := Process(tmpl, WithFS(fsys), WithArgument("region", "eu"),
+		WithTagHandler("!local", func(ctx *TagContext, node *yaml.Node) (string, error) {
+			ctx.KeepString = true
+			return ctx.Name + "-" + node.Value, nil
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cfg map[string]any
+	if err := decode(out, &cfg); err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	expected := map[string]any{
+		"port": 5432, "flag": true, "user": "admin", "pass": "s3cret", "cert": "dHJ1ZQ==",
+		"region": "eu", "zone": "a", "hosts": []any{"eu", "B C"}, "name": "name-x",
+	}
+	if !reflect.DeepEqual(cfg, expected) {
+		t.Fatalf("unexpected values: %v\n%s", cfg, out)
+	}
+
+	_, err = Process([]byte("a: !env GENCFG_TEST_MISSING\n"))
+	if err == nil || !strings.Contains(err.Error(), "environment variable 'GENCFG_TEST_MISSING' is not set") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// values are never parsed as YAML documents: no comments, mappings or folded lines
+	t.Setenv("GENCFG_TEST_PAIR", "p: w")
+	pem := "-----BEGIN CERTIFICATE-----\nMIIB\nIjAN\n-----END CERTIFICATE-----"
+	fsys["secrets/hash"] = &fstest.MapFile{Data: []byte("abc #123\n")}
+	fsys["cert.pem"] = &fstest.MapFile{Data: []byte(pem + "\n")}
+	tmpl = []byte(`
+pair: !env GENCFG_TEST_PAIR
+hash: !arg hash
+secret: !file secrets/hash
+cert: !file cert.pem
+empty: !arg [missing, ""]
+`)
+	out, err = Process(tmpl, WithFS(fsys), WithArgument("hash", "abc #123"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg = nil
+	if err := decode(out, &cfg); err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	expected = map[string]any{"pair": "p: w", "hash": "abc #123", "secret": "abc #123", "cert": pem, "empty": ""}
+	if !reflect.DeepEqual(cfg, expected) {
+		t.Fatalf("unexpected values: %v\n%s", cfg, out)
+	}
+
+	// with explicit structure tag values are strings too
+	out, err = Process([]byte("port: !env GENCFG_TEST_PORT\nflag: !arg [flag, true]\n"), WithExplicitStructure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg = nil
+	if err := decode(out, &cfg); err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	if expected := map[string]any{"port": "5432", "flag": "true"}; !reflect.DeepEqual(cfg, expected) {
+		t.Fatalf("unexpected values: %v\n%s", cfg, out)
+	}
+}
+
+func TestProcessComments(t *testing.T) {
+	fsys := fstest.MapFS{"partial.yaml.tmpl": {Data: []byte("# partial head\nx: 1 # x line\ny: '{{ .Name }}'\n")}}
+	tmpl := []byte(`# head comment
+a:
+  # about section
+  section: '{{ include "partial.yaml.tmpl" . }}' # section line
+  # about condition
+  !if '{{ true }}': # condition line
+    k: v
+  quoted: "untouched" # untouched line
+  list: '{{ list 1 2 | toJson }}' # list line
+`)
+	expected := `# head comment
+a:
+  # about section
+  section: # section line
+    # partial head
+    x: 1 # x line
+    y: 'section'
+  # about condition
+  # condition line
+  k: v
+  quoted: "untouched" # untouched line
+  list: [1, 2] # list line
+`
+	out, err := Process(tmpl, WithFS(fsys), WithIndent(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != expected {
+		t.Fatalf("unexpected output:\n%s", out)
+	}
+	if _, err := Process(tmpl, WithIndent(1)); err == nil {
+		t.Fatal("expected error for bad indentation")
+	}
+}
+
+func TestProcessStringTyping(t *testing.T) {
+	tmpl := []byte(`
+db:
+    password: '{{ .Arguments.password }}'
+    pin: !str '{{ .Arguments.pin }}'
+    flag: !str yes
+    port: '{{ .Arguments.port }}'
+    hosts:
+        - host: '{{ .Arguments.pin }}'
+`)
+	options := []func(*ProcessingOptions){
+		WithArgument("password", "null"), WithArgument("pin", "0123"), WithArgument("port", "5432"),
+	}
+	decodeDB := func(out []byte) map[string]any {
+		t.Helper()
+		var cfg struct{ DB map[string]any }
+		if err := decode(out, &cfg); err != nil {
+			t.Fatalf("%v\n%s", err, out)
+		}
+		return cfg.DB
+	}
+
+	out, err := Process(tmpl, append(options, WithStringField("db.password"), WithStringField("db.hosts.host"))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := decodeDB(out)
+	if db["password"] != "null" || db["pin"] != "0123" || db["flag"] != "yes" || db["port"] != 5432 {
+		t.Fatalf("unexpected values: %v\n%s", db, out)
+	}
+	if fmt.Sprint(db["hosts"]) != "[map[host:0123]]" {
+		t.Fatalf("unexpected hosts: %v\n%s", db["hosts"], out)
+	}
+
+	// only explicitly structured values are interpreted
+	tmpl = []byte(`
+db:
+    password: '{{ .Arguments.password }}'
+    port: '{{ .Arguments.port | atoi | toJson }}'
+    hosts: '{{ list "a" "b" | toJson }}'
+    name: 'a: b'
+`)
+	out, err = Process(tmpl, append(options, WithExplicitStructure())...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db = decodeDB(out)
+	if db["password"] != "null" || db["port"] != 5432 || fmt.Sprint(db["hosts"]) != "[a b]" || db["name"] != "a: b" {
+		t.Fatalf("unexpected values: %v\n%s", db, out)
+	}
+}
+
+func TestProcessData(t *testing.T) {
+	fsys := fstest.MapFS{
+		"data/servers.yaml": {Data: []byte("- host: a\n  port: 1\n- host: b\n  port: 2\n")},
+		"data/motd.txt":     {Data: []byte("yes")},
+		"certs/a.pem":       {Data: []byte("A")},
+		"certs/b.pem":       {Data: []byte("B")},
+	}
+	tmpl := []byte(`
+servers: '{{ readYaml "data/servers.yaml" | toYaml }}'
+first: '{{ (index (readYaml "data/servers.yaml") 0).host }}'
+motd: !str '{{ readFile "data/motd.txt" }}'
+certs: '{{ glob "certs/*.pem" | toJson }}'
+parsed: '{{ (fromYaml "{a: 1}").a }}'
+`)
+	var read []string
+	out, err := Process(tmpl, WithFS(fsys), WithReadFiles(&read))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cfg struct {
+		Servers []struct {
+			Host string
+			Port int
+		}
+		First  string
+		Motd   string
+		Certs  []string
+		Parsed int
+	}
+	if err := decode(out, &cfg); err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	if len(cfg.Servers) != 2 || cfg.Servers[1].Port != 2 || cfg.First != "a" || cfg.Motd != "yes" || cfg.Parsed != 1 {
+		t.Fatalf("unexpected values: %+v\n%s", cfg, out)
+	}
+	if strings.Join(cfg.Certs, ",") != "certs/a.pem,certs/b.pem" {
+		t.Fatalf("unexpected glob results: %v", cfg.Certs)
+	}
+	if strings.Join(read, ",") != "data/servers.yaml,data/motd.txt" {
+		t.Fatalf("unexpected read files: %v", read)
+	}
+
+	// on disk relative paths are resolved against project directory
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("disk"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	read = nil
+	out, err = Process([]byte(`a: '{{ glob "*.txt" | first | readFile }}'`), WithRootDir(dir), WithReadFiles(&read))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(string(out)) != "a: 'disk'" || len(read) != 1 || read[0] != filepath.Join(dir, "a.txt") {
+		t.Fatalf("unexpected output: %s, read %v", out, read)
+	}
+}
+
+func TestProcessNetwork(t *testing.T) {
+	for _, tc := range []struct {
+		cidr string
+		num  int
+		host string
+	}{
+		{"10.0.0.0/24", 5, "10.0.0.5"},
+		{"10.0.1.7/16", 258, "10.0.1.2"},
+		{"10.0.0.0/24", -2, "10.0.0.254"},
+		{"fd00::/64", 17, "fd00::11"},
+	} {
+		host, err := cidrHost(tc.cidr, tc.num)
+		if err != nil || host != tc.host {
+			t.Errorf("cidrHost(%s, %d) = %s, %v; expected %s", tc.cidr, tc.num, host, err, tc.host)
+		}
+	}
+	if _, err := cidrHost("10.0.0.0/30", 4); err == nil {
+		t.Error("expected error for host number out of range")
+	}
+
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	loopback := ""
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback != 0 && iface.Flags&net.FlagUp != 0 {
+			loopback = iface.Name
+		}
+	}
+	if len(loopback) == 0 {
+		t.Skip("no loopback interface")
+	}
+
+	tmpl := []byte(fmt.Sprintf(`
+addr: '{{ interfaceAddr %[1]q }}'
+listed: '{{ index .Interfaces %[1]q | toJson }}'
+hosts: '{{ lookupHost "localhost" | toJson }}'
+missing: '{{ lookupHost "gencfg.invalid" | toJson }}'
+subnet: '{{ cidrHost "192.168.0.0/16" 257 }}'
+`, loopback))
+	out, err := Process(tmpl, WithLenientDNS())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cfg struct {
+		Addr    string
+		Listed  []string
+		Hosts   []string
+		Missing []string
+		Subnet  string
+	}
+	if err := decode(out, &cfg); err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	if !net.ParseIP(cfg.Addr).IsLoopback() || !slices.Contains(cfg.Listed, cfg.Addr) || len(cfg.Hosts) == 0 ||
+		len(cfg.Missing) != 0 || cfg.Subnet != "192.168.1.1" {
+		t.Fatalf("unexpected values: %+v\n%s", cfg, out)
+	}
+	if _, err := Process([]byte(`a: '{{ lookupHost "gencfg.invalid" }}'`)); err == nil {
+		t.Fatal("expected name resolution error")
+	}
+}
+
+func TestProcessHostAddresses(t *testing.T) {
+	// localhost resolves to loopback addresses only
+	if ipv4, ipv6, err := getHostIPs("localhost"); err != nil || len(ipv4) != 0 || len(ipv6) != 0 {
+		t.Fatalf("unexpected localhost addresses: '%s' '%s' %v", ipv4, ipv6, err)
+	}
+
+	out, err := Process([]byte("ipv4: '{{ .IPv4 }}'\nipv6: '{{ .IPv6 }}'\n"), WithLenientDNS())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cfg struct {
+		IPv4, IPv6, Primary string
+	}
+	if err := decode(out, &cfg); err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	if ip := net.ParseIP(cfg.IPv4); len(cfg.IPv4) > 0 && (ip == nil || ip.To4() == nil || ip.IsLoopback()) {
+		t.Fatalf("unexpected IPv4 value: %s", cfg.IPv4)
+	}
+	if ip := net.ParseIP(cfg.IPv6); len(cfg.IPv6) > 0 && (ip == nil || ip.To4() != nil || ip.IsLoopback()) {
+		t.Fatalf("unexpected IPv6 value: %s", cfg.IPv6)
+	}
+
+	expected, err := primaryIP()
+	if err != nil {
+		t.Skipf("no outbound route: %v", err)
+	}
+	out, err = Process([]byte("primary: '{{ primaryIP }}'\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := decode(out, &cfg); err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	if cfg.Primary != expected || net.ParseIP(cfg.Primary) == nil {
+		t.Fatalf("unexpected primary address: %s, expected %s", cfg.Primary, expected)
+	}
+}
+
+func TestProcessFreePorts(t *testing.T) {
+	tmpl := []byte(`
+local: '{{ freeLocalPort }}'
+udp: '{{ freePort "udp" "0.0.0.0" }}'
+any: '{{ freePort "tcp" "0.0.0.0" }}'
+ranged: '{{ freePortInRange 20000 30000 }}'
+block: '{{ freePorts 3 | toJson }}'
+`)
+	out, err := Process(tmpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cfg struct {
+		Local, UDP, Any, Ranged int
+		Block                   []int
+	}
+	if err := decode(out, &cfg); err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	if cfg.Ranged < 20000 || cfg.Ranged > 30000 {
+		t.Fatalf("port %d is out of range", cfg.Ranged)
+	}
+	if len(cfg.Block) != 3 || cfg.Block[1] != cfg.Block[0]+1 || cfg.Block[2] != cfg.Block[0]+2 {
+		t.Fatalf("unexpected block of ports: %v", cfg.Block)
+	}
+	// all ports are reserved in the same map and never repeat
+	seen := map[int]bool{}
+	for _, port := range append([]int{cfg.Local, cfg.UDP, cfg.Any, cfg.Ranged}, cfg.Block...) {
+		if port == 0 || seen[port] {
+			t.Fatalf("unexpected port %d in %+v", port, cfg)
+		}
+		seen[port] = true
+	}
+
+	// the only port in range is already taken
+	if _, err := freePortInRange(cfg.Ranged, cfg.Ranged); err == nil {
+		t.Fatal("expected error for exhausted range")
+	}
+	if _, err := freePort("sctp"); err == nil || !strings.Contains(err.Error(), "unsupported network") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+package gencfg
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+)
+
+// readPartial finds partial by name and reads it. Relative names are looked up in project directory
+// (or file system set with WithFS), then in include directories and finally in include file system.
+// It returns location of the partial for cycle detection.
+func (exp *expansion) readPartial(name string) (string, []byte, error) {
+	if filepath.IsAbs(name) {
+		return exp.opts.readFile(name)
+	}
+
+	dirs := append([]string{"."}, exp.opts.includeDirs...)
+	for _, dir := range dirs {
+		key, data, err := exp.opts.readFile(filepath.Join(dir, name))
+		if err == nil {
+			return key, data, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", nil, err
+		}
+	}
+	if exp.opts.includeFS != nil {
+		name := path.Clean(filepath.ToSlash(name))
+		data, err := fs.ReadFile(exp.opts.includeFS, name)
+		return "include:" + name, data, err
+	}
+	return "", nil, fmt.Errorf("partial '%s' not found: %w", name, fs.ErrNotExist)
+}
+
+// include implements "include" template function: it expands partial as a template with the given
+// data and returns the result, which is interpreted as YAML fragment the same way as any other expanded
+// value. Including partial is considered explicit emission of structured data.
+func (exp *expansion) include(name string, data any) (string, error) {
+	key, src, err := exp.readPartial(name)
+	if err != nil {
+		return "", fmt.Errorf("unable to read partial '%s': %w", name, err)
+	}
+	if slices.Contains(exp.stack, key) {
+		return "", fmt.Errorf("include cycle detected: %s -> %s", strings.Join(exp.stack, " -> "), key)
+	}
+	exp.structured = true
+	exp.stack = append(exp.stack, key)
+	defer func() { exp.stack = exp.stack[:len(exp.stack)-1] }()
+
+	tmpl, err := template.New(name).Funcs(newFuncMap(exp)).Parse(string(src))
+	if err != nil {
+		return "", err
+	}
+	buf := new(bytes.Buffer)
+	if err := tmpl.Execute(buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,156 @@
+package gencfg
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// LoadOptions holds options for loading configuration.
+type LoadOptions struct {
+	files     []string
+	envPrefix string
+	process   []func(*ProcessingOptions)
+	sanitize  []func(*SanitizeOptions)
+	validate  []func(*ValdatorOptions)
+}
+
+// WithConfigFile adds configuration file which values are superimposed on top of
+// expanded configuration template. Could be used several times, files are applied in order,
+// empty path is ignored.
+func WithConfigFile(path string) func(*LoadOptions) {
+	return func(opts *LoadOptions) {
+		if len(path) > 0 {
+			opts.files = append(opts.files, path)
+		}
+	}
+}
+
+// WithEnvPrefix turns on automatic binding of configuration fields to environment variables
+// with specified prefix, see ApplyEnv. Fields with "env" tag are always bound.
+func WithEnvPrefix(prefix string) func(*LoadOptions) {
+	return func(opts *LoadOptions) {
+		opts.envPrefix = prefix
+	}
+}
+
+// WithProcessingOptions sets options for configuration template expansion and defaults.
+func WithProcessingOptions(options ...func(*ProcessingOptions)) func(*LoadOptions) {
+	return func(opts *LoadOptions) {
+		opts.process = append(opts.process, options...)
+	}
+}
+
+// WithSanitizeOptions sets options for sanitizing loaded configuration.
+func WithSanitizeOptions(options ...func(*SanitizeOptions)) func(*LoadOptions) {
+	return func(opts *LoadOptions) {
+		opts.sanitize = append(opts.sanitize, options...)
+	}
+}
+
+// WithValidateOptions sets options for validating loaded configuration.
+func WithValidateOptions(options ...func(*ValdatorOptions)) func(*LoadOptions) {
+	return func(opts *LoadOptions) {
+		opts.validate = append(opts.validate, options...)
+	}
+}
+
+// decode unmarshals YAML data into cfg, we want to use only fields we defined so
+// we cannot use yaml.Unmarshal directly here.
+func decode(data []byte, cfg any) error {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+// readConfigFile reads configuration file, relative paths are resolved in the file system
+// set with WithFS if any, or against current directory as usual.
+func readConfigFile(path string, popts *ProcessingOptions) ([]byte, error) {
+	if popts.fsys != nil && !filepath.IsAbs(path) {
+		return fs.ReadFile(popts.fsys, filepath.ToSlash(filepath.Clean(path)))
+	}
+	return os.ReadFile(path)
+}
+
+// Load implements the whole configuration loading pipeline: it applies defaults from struct tags
+// to the empty fields of cfg (pointer to struct), expands configuration template and decodes it
+// into cfg, superimposes values from configuration files and environment variables on top of it,
+// and finally sanitizes and validates the result. Since defaults are applied first, zero values
+// set explicitly (enabled: false) are kept. Structures created by decoding (behind pointers, in
+// slices and maps) get defaults for the fields which are not present in decoded data.
+//
+// Unless specified otherwise with WithSanitizeOptions, relative paths are sanitized
+// against the same root directory which is used for template expansion.
+func Load(tmpl []byte, cfg any, options ...func(*LoadOptions)) error {
+	opts := &LoadOptions{}
+	for _, setOpt := range options {
+		setOpt(opts)
+	}
+
+	popts, err := newProcessingOptions(opts.process)
+	if err != nil {
+		return err
+	}
+
+	// defaults go first, so explicit zero values from template, files and environment override them
+	if err := ApplyDefaults(cfg, opts.process...); err != nil {
+		return fmt.Errorf("failed to apply configuration defaults: %w", err)
+	}
+
+	data, err := Process(tmpl, opts.process...)
+	if err != nil {
+		return fmt.Errorf("failed to process configuration template: %w", err)
+	}
+	if err := decodeWithDefaults(data, cfg, popts); err != nil {
+		return fmt.Errorf("failed to decode configuration template: %w", err)
+	}
+	for _, path := range opts.files {
+		data, err := readConfigFile(path, popts)
+		if err != nil {
+			return fmt.Errorf("failed to read config file: %w", err)
+		}
+		if err := decodeWithDefaults(data, cfg, popts); err != nil {
+			return fmt.Errorf("failed to decode configuration file '%s': %w", path, err)
+		}
+	}
+	if err := ApplyEnv(cfg, opts.envPrefix); err != nil {
+		return fmt.Errorf("failed to apply environment variables: %w", err)
+	}
+	return opts.check(cfg, popts.rootDir)
+}
+
+// Check sanitizes and validates configuration (pointer to struct) the same way Load does it with the
+// same options, for example after some values were changed from command line.
+func Check(cfg any, options ...func(*LoadOptions)) error {
+	opts := &LoadOptions{}
+	for _, setOpt := range options {
+		setOpt(opts)
+	}
+	popts, err := newProcessingOptions(opts.process)
+	if err != nil {
+		return err
+	}
+	return opts.check(cfg, popts.rootDir)
+}
+
+// check sanitizes and validates loaded configuration, relative paths are sanitized against rootDir
+// unless base directory is specified in sanitize options.
+func (opts *LoadOptions) check(cfg any, rootDir string) error {
+	sanitize := append([]func(*SanitizeOptions){WithBaseDir(rootDir)}, opts.sanitize...)
+	if err := Sanitize(cfg, sanitize...); err != nil {
+		return fmt.Errorf("failed to sanitize configuration: %w", err)
+	}
+	if err := Validate(cfg, opts.validate...); err != nil {
+		return fmt.Errorf("failed to validate configuration: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+package gencfg
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+type dbConfig struct {
+	User    string        `yaml:"user" default:"admin" validate:"required"`
+	Port    int           `yaml:"port" default:"5432" sanitize:"clamp=1:65535"`
+	Timeout time.Duration `yaml:"timeout" default:"30s"`
+}
+
+type loadConfig struct {
+	DataDir  string               `yaml:"data_dir" default:"{{ joinPath .ProjectDir \"data\" }}" sanitize:"path_clean"`
+	Name     string               `yaml:"name" default:"{{ .Name }}-{{ .Arguments.suffix }}"`
+	Limit    ByteSize             `yaml:"limit" default:"1MiB"`
+	Enabled  *bool                `yaml:"enabled" default:"true"`
+	DB       dbConfig             `yaml:"db"`
+	Replicas []dbConfig           `yaml:"replicas"`
+	Shards   map[string]*dbConfig `yaml:"shards"`
+}
+
+func TestApplyDefaults(t *testing.T) {
+	cfg := loadConfig{
+		Name:     "set",
+		Replicas: []dbConfig{{User: "replica"}},
+		Shards:   map[string]*dbConfig{"a": {Port: 1}},
+	}
+	if err := ApplyDefaults(&cfg, WithRootDir("/project"), WithArgument("suffix", "x")); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.DataDir != filepath.Join("/project", "data") || cfg.Name != "set" || cfg.Limit != MiB || cfg.Enabled == nil || !*cfg.Enabled {
+		t.Fatalf("unexpected top level values: %+v", cfg)
+	}
+	if cfg.DB != (dbConfig{User: "admin", Port: 5432, Timeout: 30 * time.Second}) {
+		t.Fatalf("unexpected nested values: %+v", cfg.DB)
+	}
+	if cfg.Replicas[0].User != "replica" || cfg.Replicas[0].Port != 5432 || cfg.Shards["a"].Port != 1 || cfg.Shards["a"].User != "admin" {
+		t.Fatalf("unexpected values: %+v %+v", cfg.Replicas, cfg.Shards["a"])
+	}
+
+	var named loadConfig
+	if err := ApplyDefaults(&named, WithArgument("suffix", "x")); err != nil {
+		t.Fatal(err)
+	}
+	if named.Name != "name-x" {
+		t.Fatalf("got %s, want name-x", named.Name)
+	}
+
+	bad := struct {
+		Port int `default:"many"`
+	}{}
+	if err := ApplyDefaults(&bad); err == nil || !strings.Contains(err.Error(), "Port") {
+		t.Fatalf("expected error naming the field, got %v", err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	tmpl := []byte(`
+data_dir: '{{ joinPath .ProjectDir "store" "." }}'
+db:
+  port: 70000
+`)
+	file := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(file, []byte("enabled: false\nlimit: 0\ndb:\n  user: someone\n  timeout: 0s\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var cfg loadConfig
+	err := Load(tmpl, &cfg,
+		WithConfigFile(file),
+		WithProcessingOptions(WithRootDir(dir), WithArgument("suffix", "y")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.DataDir != filepath.Join(dir, "store") || cfg.Name != "name-y" {
+		t.Fatalf("unexpected values: %+v", cfg)
+	}
+	if cfg.DB != (dbConfig{User: "someone", Port: 65535}) {
+		t.Fatalf("unexpected db values: %+v", cfg.DB)
+	}
+	// explicit zero values from configuration file must not be replaced by defaults
+	if cfg.Enabled == nil || *cfg.Enabled || cfg.Limit != 0 {
+		t.Fatalf("explicit zero values were overwritten: %+v", cfg)
+	}
+
+	if err := os.WriteFile(file, []byte("unknown: 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Load(tmpl, &loadConfig{}, WithConfigFile(file)); err == nil {
+		t.Fatal("expected error for unknown field")
+	}
+}
+
+func TestLoadDecodedDefaults(t *testing.T) {
+	type config struct {
+		DB     *dbConfig           `yaml:"db"`
+		Shards []dbConfig          `yaml:"shards"`
+		M      map[string]dbConfig `yaml:"m"`
+		P      map[string]*dbConfig
+	}
+	tmpl := []byte(`
+db: {user: a, timeout: 0s}
+shards: [{user: b, timeout: 0s}, {}]
+m: {x: {user: c}}
+p: {y: {port: 1}}
+`)
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(file, []byte("db:\n  user: z\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var cfg config
+	if err := Load(tmpl, &cfg, WithConfigFile(file)); err != nil {
+		t.Fatal(err)
+	}
+	// structures allocated by decoding get defaults for the fields which are not present
+	if cfg.DB == nil || *cfg.DB != (dbConfig{User: "z", Port: 5432}) {
+		t.Fatalf("unexpected pointer values: %+v", cfg.DB)
+	}
+	expected := []dbConfig{{User: "b", Port: 5432}, {User: "admin", Port: 5432, Timeout: 30 * time.Second}}
+	if !reflect.DeepEqual(cfg.Shards, expected) {
+		t.Fatalf("unexpected slice values: %+v", cfg.Shards)
+	}
+	if cfg.M["x"] != (dbConfig{User: "c", Port: 5432, Timeout: 30 * time.Second}) {
+		t.Fatalf("unexpected map values: %+v", cfg.M)
+	}
+	if *cfg.P["y"] != (dbConfig{User: "admin", Port: 1, Timeout: 30 * time.Second}) {
+		t.Fatalf("unexpected map values: %+v", cfg.P["y"])
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	type envConfig struct {
+		User    string            `yaml:"user" env:"GENCFG_TEST_USER"`
+		Port    int               `yaml:"port"`
+		Debug   bool              `yaml:"debug"`
+		Timeout time.Duration     `yaml:"timeout"`
+		Hosts   []string          `yaml:"hosts"`
+		Labels  map[string]int    `yaml:"labels"`
+		Skipped string            `yaml:"skipped" env:"-"`
+		DB      *dbConfig         `yaml:"db"`
+		Unset   *dbConfig         `yaml:"unset"`
+		Extra   map[string]string `yaml:"extra"`
+	}
+	t.Setenv("GENCFG_TEST_USER", "tagged")
+	t.Setenv("APP_PORT", "8080")
+	t.Setenv("APP_DEBUG", "true")
+	t.Setenv("APP_TIMEOUT", "1m")
+	t.Setenv("APP_HOSTS", "a, b,c")
+	t.Setenv("APP_LABELS", "x=1,y=2")
+	t.Setenv("APP_SKIPPED", "no")
+	t.Setenv("APP_DB_USER", "nested")
+	// structures are not bound automatically, their fields are
+	t.Setenv("APP_DB", "ignored")
+	t.Setenv("APP_UNSET", "ignored")
+
+	var cfg envConfig
+	if err := ApplyEnv(&cfg, "app"); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.User != "tagged" || cfg.Port != 8080 || !cfg.Debug || cfg.Timeout != time.Minute || cfg.Skipped != "" {
+		t.Fatalf("unexpected values: %+v", cfg)
+	}
+	if strings.Join(cfg.Hosts, "|") != "a|b|c" || len(cfg.Labels) != 2 || cfg.Labels["y"] != 2 {
+		t.Fatalf("unexpected collections: %+v %+v", cfg.Hosts, cfg.Labels)
+	}
+	if cfg.DB == nil || cfg.DB.User != "nested" || cfg.Unset != nil || cfg.Extra != nil {
+		t.Fatalf("unexpected nested values: %+v %+v", cfg.DB, cfg.Unset)
+	}
+
+	// without prefix only tagged fields are bound
+	cfg = envConfig{}
+	if err := ApplyEnv(&cfg, ""); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.User != "tagged" || cfg.Port != 0 || cfg.DB != nil {
+		t.Fatalf("unexpected values without prefix: %+v", cfg)
+	}
+
+	t.Setenv("APP_PORT", "many")
+	t.Setenv("APP_LABELS", "x")
+	err := ApplyEnv(&cfg, "APP")
+	if err == nil || !strings.Contains(err.Error(), "'APP_PORT' to 'Port'") || !strings.Contains(err.Error(), "'APP_LABELS' to 'Labels'") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Load binds environment and validates result
+	t.Setenv("APP_DB_PORT", "99999")
+	var lcfg loadConfig
+	if err := Load([]byte("db:\n  user: someone\n"), &lcfg, WithEnvPrefix("APP")); err != nil {
+		t.Fatal(err)
+	}
+	if lcfg.DB.User != "nested" || lcfg.DB.Port != 65535 {
+		t.Fatalf("unexpected loaded values: %+v", lcfg.DB)
+	}
+}
+
+func TestLoadFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"config.yaml.tmpl":      {Data: []byte(`db: '{{ include "partials/db.yaml.tmpl" . }}'`)},
+		"partials/db.yaml.tmpl": {Data: []byte("user: '{{ .Arguments.user }}'\nport: 70000\n")},
+		"local/config.yaml":     {Data: []byte("name: local\n")},
+	}
+	tmpl, err := fs.ReadFile(fsys, "config.yaml.tmpl")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var cfg loadConfig
+	err = Load(tmpl, &cfg,
+		WithConfigFile("local/config.yaml"),
+		WithProcessingOptions(WithRootDir("/project"), WithFS(fsys), WithArgument("user", "embedded")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Name != "local" || cfg.DB.User != "embedded" || cfg.DB.Port != 65535 {
+		t.Fatalf("unexpected values: %+v", cfg)
+	}
+
+	err = Load(tmpl, &cfg, WithConfigFile("missing.yaml"), WithProcessingOptions(WithFS(fsys)))
+	if err == nil || !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected missing file error, got: %v", err)
+	}
+}
@@ -4,7 +4,11 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"math/big"
+	"math/rand/v2"
 	"net"
+	"net/netip"
+	"strconv"
 	"sync"
 )
 
@@ -14,19 +18,31 @@ var guard sync.Mutex
 // keep track of ports we already allocated
 var portMap = make(map[int]struct{})
 
-// getFreePort returns a free port number on the local machine.
-func getFreePort() (int, error) {
-	addr, err := net.ResolveTCPAddr("tcp", "127.0.0.1:0")
-	if err != nil {
-		return 0, fmt.Errorf("unable to resolve TCPAddr: %w", err)
-	}
-	l, err := net.ListenTCP("tcp", addr)
-	if err != nil {
-		return 0, fmt.Errorf("unable to ListenTCP: %w", err)
+// listenPort checks if port (0 for any) could be used by binding to it and returns it.
+func listenPort(network, host string, port int) (int, error) {
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+		l, err := net.Listen(network, addr)
+		if err != nil {
+			return 0, fmt.Errorf("unable to listen on %s %s: %w", network, addr, err)
+		}
+		defer l.Close()
+		return l.Addr().(*net.TCPAddr).Port, nil
+	case "udp", "udp4", "udp6":
+		c, err := net.ListenPacket(network, addr)
+		if err != nil {
+			return 0, fmt.Errorf("unable to listen on %s %s: %w", network, addr, err)
+		}
+		defer c.Close()
+		return c.LocalAddr().(*net.UDPAddr).Port, nil
 	}
-	defer l.Close()
+	return 0, fmt.Errorf("unsupported network '%s'", network)
+}
 
-	return l.Addr().(*net.TCPAddr).Port, nil
+// getFreePort returns a free port number on the local machine.
+func getFreePort(network, host string) (int, error) {
+	return listenPort(network, host, 0)
 }
 
 // reservePort reserves a port number we are going to use.
@@ -40,10 +56,44 @@ func reservePort(port int) bool {
 	return true
 }
 
+// releasePort releases reserved port which turned out to be unusable.
+func releasePort(port int) {
+	guard.Lock()
+	defer guard.Unlock()
+	delete(portMap, port)
+}
+
+// portTarget returns network and host from optional template function arguments,
+// default is "tcp" on "127.0.0.1".
+func portTarget(args []string) (string, string, error) {
+	network, host := "tcp", "127.0.0.1"
+	switch len(args) {
+	case 2:
+		host = args[1]
+		fallthrough
+	case 1:
+		network = args[0]
+	case 0:
+	default:
+		return "", "", fmt.Errorf("expected optional network and host, got %d arguments", len(args))
+	}
+	return network, host, nil
+}
+
 // freeLocalPort returns a free port number on the local machine for template expansion.
 func freeLocalPort() (int, error) {
+	return freePort()
+}
+
+// freePort returns a free port number for template expansion. Optional arguments are network
+// ("tcp", "udp", "tcp6"...) and host to bind to, for example: freePort "udp" "0.0.0.0".
+func freePort(args ...string) (int, error) {
+	network, host, err := portTarget(args)
+	if err != nil {
+		return 0, err
+	}
 	for range math.MaxUint16 {
-		port, err := getFreePort()
+		port, err := getFreePort(network, host)
 		if err != nil {
 			return 0, err
 		}
@@ -54,3 +104,174 @@ func freeLocalPort() (int, error) {
 	}
 	return 0, errors.New("unable to find free port")
 }
+
+// freePortInRange returns a free port number from the range (inclusive) for template expansion,
+// optional arguments are the same as for freePort: freePortInRange 20000 30000 "udp".
+func freePortInRange(low, high int, args ...string) (int, error) {
+	network, host, err := portTarget(args)
+	if err != nil {
+		return 0, err
+	}
+	if low < 1 || high > math.MaxUint16 || low > high {
+		return 0, fmt.Errorf("invalid port range %d-%d", low, high)
+	}
+	size := high - low + 1
+	start := rand.IntN(size)
+	for i := range size {
+		port := low + (start+i)%size
+		if !reservePort(port) {
+			continue
+		}
+		if _, err := listenPort(network, host, port); err != nil {
+			releasePort(port)
+			continue
+		}
+		return port, nil
+	}
+	return 0, fmt.Errorf("unable to find free port in range %d-%d", low, high)
+}
+
+// freePorts returns block of contiguous free port numbers for template expansion, optional
+// arguments are the same as for freePort: freePorts 3 "tcp" "0.0.0.0".
+func freePorts(count int, args ...string) ([]int, error) {
+	network, host, err := portTarget(args)
+	if err != nil {
+		return nil, err
+	}
+	if count < 1 || count > math.MaxUint16 {
+		return nil, fmt.Errorf("invalid number of ports %d", count)
+	}
+	// start with port system considers free and check the following ones
+	for range 1024 {
+		first, err := getFreePort(network, host)
+		if err != nil {
+			return nil, err
+		}
+		if first+count-1 > math.MaxUint16 {
+			continue
+		}
+		ports := make([]int, 0, count)
+		usable := true
+		for port := first; usable && port < first+count; port++ {
+			if usable = reservePort(port); usable {
+				ports = append(ports, port)
+				_, err := listenPort(network, host, port)
+				usable = err == nil
+			}
+		}
+		if usable {
+			return ports, nil
+		}
+		for _, port := range ports {
+			releasePort(port)
+		}
+	}
+	return nil, fmt.Errorf("unable to find %d contiguous free ports", count)
+}
+
+// getInterfaces returns addresses of network interfaces which are up by interface name.
+func getInterfaces() (map[string][]string, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, fmt.Errorf("unable to list network interfaces: %w", err)
+	}
+	result := make(map[string][]string, len(ifaces))
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return nil, fmt.Errorf("unable to get addresses of interface '%s': %w", iface.Name, err)
+		}
+		ips := make([]string, 0, len(addrs))
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok {
+				ips = append(ips, ipnet.IP.String())
+			}
+		}
+		result[iface.Name] = ips
+	}
+	return result, nil
+}
+
+// interfaceAddr returns the first IPv4 address of the network interface (or the first IPv6
+// address if interface has no IPv4 ones) for template expansion.
+func interfaceAddr(name string) (string, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return "", fmt.Errorf("unable to find interface '%s': %w", name, err)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return "", fmt.Errorf("unable to get addresses of interface '%s': %w", name, err)
+	}
+	var ipv6 string
+	for _, addr := range addrs {
+		ipnet, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		if ipv4 := ipnet.IP.To4(); ipv4 != nil {
+			return ipv4.String(), nil
+		}
+		if len(ipv6) == 0 {
+			ipv6 = ipnet.IP.String()
+		}
+	}
+	if len(ipv6) == 0 {
+		return "", fmt.Errorf("interface '%s' has no IP addresses", name)
+	}
+	return ipv6, nil
+}
+
+// primaryIP returns local address of the outbound route for template expansion. Connecting UDP
+// socket only selects route, so no packets are sent. IPv6 route is used when there is no IPv4 one.
+func primaryIP() (string, error) {
+	var errs []error
+	// documentation addresses, they are routed through default gateway
+	for _, target := range []string{"192.0.2.1:9", "[2001:db8::1]:9"} {
+		conn, err := net.Dial("udp", target)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		addr := conn.LocalAddr().(*net.UDPAddr)
+		conn.Close()
+		return addr.IP.String(), nil
+	}
+	return "", fmt.Errorf("unable to find outbound route: %w", errors.Join(errs...))
+}
+
+// cidrHost returns address of the host with given number in the network prefix for template
+// expansion, negative numbers count from the end of the range: cidrHost "10.0.0.0/24" 5 is 10.0.0.5.
+func cidrHost(cidr string, num int) (string, error) {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return "", err
+	}
+	size := new(big.Int).Lsh(big.NewInt(1), uint(prefix.Addr().BitLen()-prefix.Bits()))
+	host := big.NewInt(int64(num))
+	if num < 0 {
+		host.Add(host, size)
+	}
+	if host.Sign() < 0 || host.Cmp(size) >= 0 {
+		return "", fmt.Errorf("host number %d does not fit into '%s'", num, cidr)
+	}
+	base := prefix.Masked().Addr().AsSlice()
+	value := new(big.Int).SetBytes(base)
+	addr, _ := netip.AddrFromSlice(value.Add(value, host).FillBytes(make([]byte, len(base))))
+	return addr.String(), nil
+}
+
+// lookupHost implements "lookupHost" template function, it returns addresses of the host.
+func (exp *expansion) lookupHost(host string) ([]string, error) {
+	addrs, err := net.LookupHost(host)
+	if err != nil {
+		if exp.opts.lenientDNS {
+			return []string{}, nil
+		}
+		return nil, err
+	}
+	return addrs, nil
+}
@@ -1,65 +1,314 @@
 package gencfg
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"reflect"
+	"strconv"
 	"strings"
-	"testing"
+	"sync"
 )
 
-// sanitizeTestFunctions only used by Sanitize tests and should never be invoked otherwise.
-type sanitizeTestFunctions struct{}
+// SanitizeContext describes configuration field being sanitized to sanitizer functions.
+type SanitizeContext struct {
+	// Name is the name of the configuration field being sanitized.
+	Name string
+	// Path is the full path of the value being sanitized, for example Servers["eu"].TLS.CertFile.
+	Path string
+	// Tag is the name of the sanitize action being performed.
+	Tag string
+	// Args holds the action argument split into parameters on unquoted ':'.
+	Args []string
 
-// ReportTestCall is a test function that could be called by the sanitize function with the tag sanitize:"test_call=ReportTestCall".
-// Add more test methods with the same signature to sanitizeTestFunctions as needed.
-func (sanitizeTestFunctions) ReportTestCall(name, data string) error {
-	fmt.Println("ReportTestCall called with", name, data)
-	return nil
+	opts *SanitizeOptions
 }
 
-func (s sanitizeTestFunctions) invokeMethodByName(methodName, paramName, paramValue string) error {
-	method := reflect.ValueOf(s).MethodByName(methodName)
-	if !method.IsValid() {
-		return fmt.Errorf("function '%s' not found for '%s', value='%s'", methodName, paramName, paramValue)
+// BaseDir returns absolute directory relative paths are resolved against by path sanitizers.
+func (ctx SanitizeContext) BaseDir() string {
+	return ctx.opts.baseDir
+}
+
+// DryRun reports if sanitize actions should not have any side effects on the file system.
+// Actions are expected to record planned operations with RecordEffect instead.
+func (ctx SanitizeContext) DryRun() bool {
+	return ctx.opts.dryRun
+}
+
+// RecordEffect records file system operation performed (or planned in dry-run mode) by sanitize action.
+func (ctx SanitizeContext) RecordEffect(action, path string) {
+	if ctx.opts.effects != nil {
+		*ctx.opts.effects = append(*ctx.opts.effects, SanitizeEffect{Action: action, Path: path, Field: ctx.Path})
+	}
+}
+
+// mkdirAll creates directory with all parents unless in dry-run mode.
+func (ctx SanitizeContext) mkdirAll(dir string) error {
+	ctx.RecordEffect(EffectMkdir, dir)
+	if ctx.opts.dryRun {
+		return nil
+	}
+	return os.MkdirAll(dir, ctx.opts.dirMode)
+}
+
+// access records access check and reports if it should be actually performed.
+func (ctx SanitizeContext) access(path string) bool {
+	ctx.RecordEffect(EffectAccess, path)
+	return !ctx.opts.dryRun
+}
+
+// resolve makes relative path absolute using base directory.
+func (ctx SanitizeContext) resolve(path string) string {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(ctx.opts.baseDir, path)
+}
+
+// SanitizerFunc performs a single sanitize action on the value. Value is always settable,
+// arg holds the action argument (part of the tag after '=' with quoting removed) if any.
+type SanitizerFunc func(ctx SanitizeContext, v reflect.Value, arg string) error
+
+// Kinds of file system operations performed by built-in sanitize actions.
+const (
+	EffectMkdir  = "mkdir"
+	EffectAccess = "access"
+)
+
+// SanitizeEffect describes file system operation performed (or planned in dry-run mode) by sanitize action.
+type SanitizeEffect struct {
+	// Action is the kind of operation, EffectMkdir or EffectAccess for built-in actions.
+	Action string
+	// Path is the file system path operation is performed on.
+	Path string
+	// Field is the path of the configuration field which caused the operation.
+	Field string
+}
+
+// SanitizeOptions holds options for sanitizing configuration structures.
+type SanitizeOptions struct {
+	baseDir    string
+	dryRun     bool
+	dirMode    os.FileMode
+	effects    *[]SanitizeEffect
+	sanitizers map[string]SanitizerFunc
+}
+
+// WithDryRun prevents sanitize actions from changing anything on disk: directories are
+// not created and file access checks are skipped. Use WithEffects to see what would have been done.
+func WithDryRun() func(*SanitizeOptions) {
+	return func(opts *SanitizeOptions) {
+		opts.dryRun = true
+	}
+}
+
+// WithEffects collects file system operations performed (or planned in dry-run mode) by sanitize actions.
+func WithEffects(effects *[]SanitizeEffect) func(*SanitizeOptions) {
+	return func(opts *SanitizeOptions) {
+		opts.effects = effects
+	}
+}
+
+// WithDirMode sets permissions for directories created by assure_dir_exists* actions (before umask), default is 0777.
+func WithDirMode(mode os.FileMode) func(*SanitizeOptions) {
+	return func(opts *SanitizeOptions) {
+		opts.dirMode = mode
 	}
-	res := method.Call([]reflect.Value{reflect.ValueOf(paramName), reflect.ValueOf(paramValue)})
-	if len(res) > 0 && !res[0].IsNil() {
-		return res[0].Interface().(error)
+}
+
+// WithBaseDir sets directory relative paths are resolved against by path_*_root
+// and path_within_root actions - when empty current directory will be used.
+// Normally this is the same directory passed to Process with WithRootDir.
+func WithBaseDir(dir string) func(*SanitizeOptions) {
+	return func(opts *SanitizeOptions) {
+		opts.baseDir = dir
+	}
+}
+
+// WithSanitizer adds sanitize action available to a single Sanitize call only.
+// It takes precedence over registered actions with the same name.
+func WithSanitizer(name string, fn SanitizerFunc) func(*SanitizeOptions) {
+	return func(opts *SanitizeOptions) {
+		if opts.sanitizers == nil {
+			opts.sanitizers = make(map[string]SanitizerFunc)
+		}
+		opts.sanitizers[name] = fn
+	}
+}
+
+// lookup finds sanitize action by name, per call actions are checked first.
+func (opts *SanitizeOptions) lookup(name string) SanitizerFunc {
+	if fn, ok := opts.sanitizers[name]; ok {
+		return fn
 	}
-	return nil
+	registryGuard.RLock()
+	defer registryGuard.RUnlock()
+	return registry[name]
+}
+
+// registry keeps all globally available sanitize actions, built-in ones included.
+var (
+	registryGuard sync.RWMutex
+	registry      = map[string]SanitizerFunc{
+		"path_clean":                 sanitizePathClean,
+		"path_abs":                   sanitizePathAbs,
+		"path_toslash":               sanitizePathToSlash,
+		"path_abs_root":              sanitizePathAbsRoot,
+		"path_rel_to_root":           sanitizePathRelToRoot,
+		"path_eval_symlinks":         sanitizePathEvalSymlinks,
+		"path_within_root":           sanitizePathWithinRoot,
+		"assure_dir_exists":          sanitizeAssureDirExists,
+		"assure_dir_exists_for_file": sanitizeAssureDirExistsForFile,
+		"assure_file_access":         sanitizeAssureFileAccess,
+		"assure_readable":            assureAccess(accessRead, "readable"),
+		"assure_writable":            assureAccess(accessWrite, "writable"),
+		"assure_executable":          assureAccess(accessExecute, "executable"),
+		"assure_is_file":             sanitizeAssureIsFile,
+		"assure_is_dir":              sanitizeAssureIsDir,
+		"assure_mode":                sanitizeAssureMode,
+		"assure_owner":               sanitizeAssureOwner,
+		"default":                    sanitizeDefault,
+		"clamp":                      sanitizeClamp,
+		"round_to":                   sanitizeRoundTo,
+		"replace":                    sanitizeReplace,
+		"regex_replace":              sanitizeRegexReplace,
+		"trim_prefix":                sanitizeTrimPrefix,
+		"trim_suffix":                sanitizeTrimSuffix,
+		"trim":                       sanitizeTrim,
+		"lower":                      transformString(strings.ToLower),
+		"upper":                      transformString(strings.ToUpper),
+		"expand_env":                 transformString(os.ExpandEnv),
+		"expand_home":                sanitizeExpandHome,
+		"unquote":                    sanitizeUnquote,
+		"normalize_newlines":         transformString(normalizeNewlines),
+		"test_call":                  sanitizeTestCall,
+	}
+)
+
+// RegisterSanitizer makes sanitize action available to all subsequent Sanitize calls
+// under the given name. Registering action with an existing name replaces it.
+func RegisterSanitizer(name string, fn func(ctx SanitizeContext, v reflect.Value, arg string) error) {
+	if len(name) == 0 || fn == nil {
+		panic("gencfg: RegisterSanitizer requires name and function")
+	}
+	registryGuard.Lock()
+	defer registryGuard.Unlock()
+	registry[name] = fn
+}
+
+// Sanitizer could be implemented by configuration types which want to sanitize themselves,
+// for example to normalize URL or log level. Sanitize method is called on fields and on
+// elements of slices, arrays and maps after actions from the sanitize tag (and for structures
+// after all their fields) have been applied. Use pointer receiver to modify the value.
+// Method of embedded structure is called once, as the promoted method of the outer structure.
+type Sanitizer interface {
+	Sanitize(ctx SanitizeContext) error
+}
+
+var sanitizerType = reflect.TypeFor[Sanitizer]()
+
+// SanitizeError describes failure of sanitizing particular configuration field.
+// Sanitize returns all such failures joined with errors.Join, use errors.As to inspect them.
+type SanitizeError struct {
+	// Path is the full path of the field, for example Servers["eu"].TLS.CertFile or Backends[3].Dir.
+	Path string
+	// Tag is the name of the failed sanitize action, empty when Sanitizer interface method failed.
+	Tag string
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *SanitizeError) Error() string {
+	path := e.Path
+	if len(path) == 0 {
+		path = "root"
+	}
+	if len(e.Tag) == 0 {
+		return fmt.Sprintf("sanitize failed on '%s': %v", path, e.Err)
+	}
+	return fmt.Sprintf("sanitize '%s' failed on '%s': %v", e.Tag, path, e.Err)
+}
+
+func (e *SanitizeError) Unwrap() error {
+	return e.Err
+}
+
+// sanitizer walks the structure applying sanitize actions and collecting errors.
+type sanitizer struct {
+	opts *SanitizeOptions
+	errs []error
+}
+
+func (s *sanitizer) fail(path, tag string, err error) {
+	var serr *SanitizeError
+	if errors.As(err, &serr) {
+		s.errs = append(s.errs, err)
+		return
+	}
+	s.errs = append(s.errs, &SanitizeError{Path: path, Tag: tag, Err: err})
 }
 
 // Sanitize function can be used as a simple and consistent interface for sanitizing structs,
 // while the more complex logic is encapsulated within the sanitize function.
-func Sanitize(inputStruct any) error {
+// All fields are processed even if some of them fail, returned error joins *SanitizeError for every failed field.
+func Sanitize(inputStruct any, options ...func(*SanitizeOptions)) error {
 	val := reflect.ValueOf(inputStruct)
 	if val.Kind() != reflect.Ptr || val.Elem().Kind() != reflect.Struct {
 		return fmt.Errorf("sanitize expected pointer to struct, got %v", val.Kind())
 	}
-	return sanitize(val, "root", "")
+
+	opts := &SanitizeOptions{dirMode: 0777}
+	for _, setOpt := range options {
+		setOpt(opts)
+	}
+
+	if len(opts.baseDir) == 0 {
+		pwd, err := os.Getwd()
+		if err != nil {
+			return fmt.Errorf("unable to get current working directory: %w", err)
+		}
+		opts.baseDir = pwd
+	} else {
+		dir, err := filepath.Abs(opts.baseDir)
+		if err != nil {
+			return fmt.Errorf("unable to get absolute path for base directory '%s': %w", opts.baseDir, err)
+		}
+		opts.baseDir = dir
+	}
+
+	s := &sanitizer{opts: opts}
+	s.sanitize(val, "", "root", nil)
+	return errors.Join(s.errs...)
 }
 
-func sanitize(val reflect.Value, name, parentTags string) error {
-	if !val.IsValid() || val.Kind() == reflect.Ptr && val.IsNil() {
-		return nil
+// fieldPath adds field name to the path of its parent.
+func fieldPath(parent, name string) string {
+	if len(parent) == 0 {
+		return name
 	}
+	return parent + "." + name
+}
 
-	element := val.Elem()
-	if element.Kind() != reflect.Struct {
-		return sanitizeValue(element, name, parentTags)
+// keyPath adds map key to the path of the map field.
+func keyPath(parent string, key reflect.Value) string {
+	if key.Kind() == reflect.String {
+		return parent + "[" + strconv.Quote(key.String()) + "]"
 	}
+	return fmt.Sprintf("%s[%v]", parent, key.Interface())
+}
 
-	for i := 0; i < element.NumField(); i++ {
-		field := element.Field(i)
-		fieldType := element.Type().Field(i)
-		if fieldType.PkgPath != "" {
-			continue // skip unexported fields
-		}
-		fieldKind := field.Kind()
-		fieldName := fieldType.Name
+// sanitize processes value val points to. Path is the full path of the value for error
+// reporting, name is the name of the field value belongs to and actions are parsed
+// sanitize tag of that field.
+func (s *sanitizer) sanitize(val reflect.Value, path, name string, actions []sanitizeAction) {
+	if !val.IsValid() || val.Kind() == reflect.Ptr && val.IsNil() {
+		return
+	}
 
+	element := val.Elem()
+	switch element.Kind() {
+	case reflect.Struct:
 		// Do not propagate tags from parent to structure fields!
 		//
 		// When a field is a structure assigning sanitize tags to this field is
@@ -68,51 +317,169 @@ func sanitize(val reflect.Value, name, parentTags string) error {
 		// NOTE: more complicated logic when sanitize actions from the parent
 		// structure are applied on child fields without tags or combined with actions
 		// on child fields is possible, but is difficult to follow in real life.
-		tags := fieldType.Tag.Get("sanitize")
+		// The only exception is embedded structure, see sanitizeStruct.
+		s.sanitizeStruct(element, path, nil)
+	case reflect.Pointer:
+		s.sanitize(element, path, name, actions)
+		return
+	case reflect.Interface:
+		s.sanitizeInterface(element, path, name, actions)
+		return
+	case reflect.Array, reflect.Slice:
+		s.sanitizeArrayOrSlice(element, path, name, s.collectionDefault(element, path, name, actions))
+	case reflect.Map:
+		s.sanitizeMap(element, path, name, s.collectionDefault(element, path, name, actions))
+	default:
+		if !s.sanitizeValue(element, path, name, actions) {
+			return
+		}
+	}
+	s.callSanitizer(val, path, name)
+}
 
-		switch fieldKind {
-		case reflect.Pointer:
-			if err := sanitize(field, fieldName, tags); err != nil {
-				return err
-			}
-		case reflect.Struct:
-			if err := sanitize(field.Addr(), fieldName, tags); err != nil {
-				return err
+// sanitizeStruct processes all exported fields of the structure. Fields of embedded structures
+// are promoted - they are reported as fields of the outer structure and when they do not have
+// sanitize tag of their own actions from the tag of embedded field are used (inherited).
+func (s *sanitizer) sanitizeStruct(element reflect.Value, path string, inherited []sanitizeAction) {
+	for i := 0; i < element.NumField(); i++ {
+		field := element.Field(i)
+		fieldType := element.Type().Field(i)
+		if !fieldType.IsExported() && !fieldType.Anonymous {
+			continue // skip unexported fields
+		}
+		fieldName := fieldType.Name
+
+		actions := inherited
+		if tags, ok := fieldType.Tag.Lookup("sanitize"); ok {
+			var err error
+			if actions, err = parseSanitizeTag(tags); err != nil {
+				s.fail(fieldPath(path, fieldName), "", fmt.Errorf("invalid sanitize tag on '%s': %w", fieldName, err))
+				continue
 			}
-		case reflect.Array, reflect.Slice:
-			if err := sanitizeArrayOrSlice(field, fieldName, tags); err != nil {
-				return err
+		}
+
+		if fieldType.Anonymous {
+			embedded := field
+			if embedded.Kind() == reflect.Pointer {
+				if embedded.IsNil() || !fieldType.IsExported() {
+					continue // cannot get to fields of unexported embedded pointer
+				}
+				embedded = embedded.Elem()
 			}
-		case reflect.Map:
-			if err := sanitizeMap(field, fieldName, tags); err != nil {
-				return err
+			if embedded.Kind() == reflect.Struct {
+				s.sanitizeStruct(embedded, path, actions)
+				// Sanitize method of embedded structure is promoted and will be called on the outer one,
+				// outer structure with its own Sanitize method overrides the embedded one
+				if !reflect.PointerTo(element.Type()).Implements(sanitizerType) {
+					s.callSanitizer(embedded.Addr(), path, fieldName)
+				}
+				continue
 			}
-		default:
-			if err := sanitizeValue(field, fieldName, tags); err != nil {
-				return err
+			if !fieldType.IsExported() {
+				continue
 			}
 		}
+		s.sanitize(field.Addr(), fieldPath(path, fieldName), fieldName, actions)
 	}
-	return nil
 }
 
-func sanitizeArrayOrSlice(field reflect.Value, name, parentTags string) error {
+// callSanitizer lets value sanitize itself if it implements Sanitizer interface.
+func (s *sanitizer) callSanitizer(val reflect.Value, path, name string) {
+	if !val.CanInterface() {
+		return
+	}
+	if v, ok := val.Interface().(Sanitizer); ok {
+		if err := v.Sanitize(SanitizeContext{Name: name, Path: path, opts: s.opts}); err != nil {
+			s.fail(path, "", err)
+		}
+	}
+}
+
+// sanitizeInterface processes value stored in the interface field.
+func (s *sanitizer) sanitizeInterface(field reflect.Value, path, name string, actions []sanitizeAction) {
+	if field.IsNil() {
+		return
+	}
+	value := field.Elem()
+	if value.Kind() == reflect.Pointer {
+		s.sanitize(value, path, name, actions)
+		return
+	}
+	// values stored in interfaces are not addressable
+	tempValue := reflect.New(value.Type())
+	tempValue.Elem().Set(value)
+	s.sanitize(tempValue, path, name, actions)
+	field.Set(tempValue.Elem())
+}
+
+func (s *sanitizer) sanitizeArrayOrSlice(field reflect.Value, path, name string, actions []sanitizeAction) {
 	for j := 0; j < field.Len(); j++ {
 		v := field.Index(j)
 		if v.Kind() != reflect.Pointer {
 			v = v.Addr()
 		}
-		if err := sanitize(v, name, parentTags); err != nil {
-			return fmt.Errorf("unable to sanitize slice/array element at index '%d': %w", j, err)
+		s.sanitize(v, fmt.Sprintf("%s[%d]", path, j), name, actions)
+	}
+}
+
+// collectionDefault applies "default" action to the collection as a whole when it is empty, rather
+// than to its elements, and returns actions left for the elements.
+func (s *sanitizer) collectionDefault(field reflect.Value, path, name string, actions []sanitizeAction) []sanitizeAction {
+	var rest []sanitizeAction
+	for _, action := range actions {
+		if action.name != "default" {
+			rest = append(rest, action)
+			continue
 		}
+		if field.Kind() != reflect.Array && field.Len() == 0 {
+			field.Set(reflect.Zero(field.Type())) // empty but not nil
+		}
+		s.sanitizeValue(field, path, name, []sanitizeAction{action})
 	}
-	return nil
+	return rest
 }
 
-func sanitizeMap(field reflect.Value, name, parentTags string) error {
+// sanitizeMap processes map values and, when "keys" action is present, map keys.
+// Keys are sanitized with actions from the argument of "keys" action, for example
+// sanitize:"keys='trim,lower',path_clean", and map is re-keyed only if all keys
+// were sanitized successfully and no two keys became the same.
+func (s *sanitizer) sanitizeMap(field reflect.Value, path, name string, actions []sanitizeAction) {
+	var keyActions []sanitizeAction
+	for i := 0; i < len(actions); i++ {
+		if actions[i].name != "keys" {
+			continue
+		}
+		parsed, err := parseSanitizeTag(actions[i].arg)
+		if err != nil {
+			s.fail(path, "keys", fmt.Errorf("invalid sanitize tag on '%s' keys: %w", name, err))
+			return
+		}
+		keyActions = append(keyActions, parsed...)
+		actions = append(actions[:i:i], actions[i+1:]...)
+		i--
+	}
+
+	type entry struct {
+		key, newKey, value reflect.Value
+	}
+	var (
+		entries []entry
+		keysOK  = true
+	)
 	iter := field.MapRange()
 	for iter.Next() {
 		key, value := iter.Key(), iter.Value()
+
+		newKey := key
+		if len(keyActions) > 0 {
+			tempKey := reflect.New(key.Type())
+			tempKey.Elem().Set(key)
+			before := len(s.errs)
+			s.sanitize(tempKey, keyPath(path, key), name, keyActions)
+			keysOK = keysOK && len(s.errs) == before
+			newKey = tempKey.Elem()
+		}
+
 		needsCopy := value.Kind() != reflect.Pointer
 
 		var tempValue reflect.Value
@@ -122,113 +489,60 @@ func sanitizeMap(field reflect.Value, name, parentTags string) error {
 			tempValue.Set(value)
 			value = tempValue.Addr()
 		}
-		if err := sanitize(value, name, parentTags); err != nil {
-			return fmt.Errorf("unable to sanitize map value with key '%s': %w", key.String(), err)
-		}
+		s.sanitize(value, keyPath(path, newKey), name, actions)
 		if needsCopy {
-			// Copy modified value back to map
-			field.SetMapIndex(key, tempValue)
+			value = tempValue
 		}
+		entries = append(entries, entry{key: key, newKey: newKey, value: value})
 	}
-	return nil
-}
 
-func sanitizeValue(elem reflect.Value, name, tags string) error {
-	kind := elem.Kind()
-	for _, tag := range strings.Split(tags, ",") {
-		if tag == "" {
-			continue
-		}
-		tagKeyValue := strings.Split(tag, "=")
-		switch tagKeyValue[0] {
-		case "path_clean":
-			if kind != reflect.String {
-				return fmt.Errorf("sanitize tag '%s' on '%s' only works on strings", tagKeyValue[0], name)
-			}
-			path := elem.String()
-			if len(path) == 0 {
-				return nil
-			}
-			elem.SetString(filepath.Clean(path))
-		case "path_abs":
-			if kind != reflect.String {
-				return fmt.Errorf("sanitize tag '%s' on '%s' only works on strings", tagKeyValue[0], name)
-			}
-			path := elem.String()
-			if len(path) == 0 {
-				return nil
-			}
-			apath, err := filepath.Abs(path)
-			if err != nil {
-				return fmt.Errorf("failed to get absolute path for '%s': %w", path, err)
-			}
-			elem.SetString(apath)
-		case "path_toslash":
-			if kind != reflect.String {
-				return fmt.Errorf("sanitize tag '%s' on '%s' only works on strings", tagKeyValue[0], name)
-			}
-			path := elem.String()
-			if len(path) == 0 {
-				return nil
-			}
-			elem.SetString(filepath.ToSlash(path))
-		case "assure_dir_exists":
-			if kind != reflect.String {
-				return fmt.Errorf("sanitize tag '%s' on '%s' only works on strings", tagKeyValue[0], name)
-			}
-			dir := elem.String()
-			if len(dir) == 0 {
-				return nil
-			}
-			if err := os.MkdirAll(dir, 0777); err != nil {
-				return fmt.Errorf("failed to create directory '%s': %w", dir, err)
-			}
-		case "assure_dir_exists_for_file":
-			if kind != reflect.String {
-				return fmt.Errorf("sanitize tag '%s' on '%s' only works on strings", tagKeyValue[0], name)
-			}
-			dir := filepath.Dir(elem.String())
-			if len(dir) == 0 {
-				return nil
+	rekey := false
+	if keysOK && len(keyActions) > 0 {
+		seen := make(map[any]reflect.Value, len(entries))
+		for _, e := range entries {
+			k := e.newKey.Interface()
+			if prev, ok := seen[k]; ok {
+				s.fail(keyPath(path, e.newKey), "keys", fmt.Errorf("keys %v and %v of '%s' become the same after sanitizing", prev, e.key, name))
+				keysOK = false
+				break
 			}
-			if err := os.MkdirAll(dir, 0777); err != nil {
-				return fmt.Errorf("failed to create directory '%s': %w", dir, err)
-			}
-		case "assure_file_access":
-			if kind != reflect.String {
-				return fmt.Errorf("sanitize tag '%s' on '%s' only works on strings", tagKeyValue[0], name)
-			}
-			name := elem.String()
-			if len(name) == 0 {
-				return nil
-			}
-			fileName, err := filepath.Abs(elem.String())
-			if err != nil {
-				return fmt.Errorf("wrong file name '%s': %w", name, err)
-			}
-			if _, err := os.Stat(fileName); err != nil {
-				return fmt.Errorf("file '%s' does not exists or is not accessible: %w", fileName, err)
-			}
-		// TODO: add more sanitize tags here when needed
+			seen[k] = e.key
+			rekey = rekey || k != e.key.Interface()
+		}
+	}
+	if rekey && keysOK {
+		for _, e := range entries {
+			field.SetMapIndex(e.key, reflect.Value{})
+		}
+	}
+	for _, e := range entries {
+		key := e.key
+		if rekey && keysOK {
+			key = e.newKey
+		}
+		// Copy modified value back to map
+		field.SetMapIndex(key, e.value)
+	}
+}
 
-		case "test_call":
-			// should only be used in testing environment
-			if !testing.Testing() {
-				return nil
-			}
-			if kind != reflect.String {
-				return fmt.Errorf("sanitize tag '%s' on '%s' only works on strings", tagKeyValue[0], name)
-			}
-			if len(tagKeyValue) < 2 {
-				return fmt.Errorf("empty test_call on '%s', must be test_call=function", name)
-			}
-			testFunctions := sanitizeTestFunctions{}
-			if err := testFunctions.invokeMethodByName(tagKeyValue[1], name, elem.String()); err != nil {
-				return fmt.Errorf("failed to test_call: %w", err)
-			}
-		default:
-			return fmt.Errorf("unknown sanitize tag: %s", tag)
+// sanitizeValue applies actions to the value stopping on the first failure,
+// it reports if all actions succeeded.
+func (s *sanitizer) sanitizeValue(elem reflect.Value, path, name string, actions []sanitizeAction) bool {
+	for _, action := range actions {
+		if action.name == "keys" {
+			s.fail(path, action.name, fmt.Errorf("sanitize tag '%s' on '%s' only works on maps", action.name, name))
+			return false
+		}
+		fn := s.opts.lookup(action.name)
+		if fn == nil {
+			s.fail(path, action.name, fmt.Errorf("unknown sanitize tag '%s' on '%s'", action.name, name))
+			return false
+		}
+		ctx := SanitizeContext{Name: name, Path: path, Tag: action.name, Args: action.args, opts: s.opts}
+		if err := fn(ctx, elem, action.arg); err != nil {
+			s.fail(path, action.name, err)
+			return false
 		}
 	}
-	return nil
+	return true
 }
@@ -0,0 +1,103 @@
+package gencfg
+
+import (
+	"fmt"
+	"strings"
+)
+
+// sanitizeAction is a single parsed action of the sanitize tag.
+type sanitizeAction struct {
+	name string
+	// arg is the action argument with quoting removed
+	arg string
+	// args is the action argument split into parameters on unquoted ':'
+	args []string
+}
+
+// parseSanitizeTag parses sanitize tag into the list of actions.
+//
+// Tag is a comma separated list of actions, each action is either a name or
+// name=argument. Argument could consist of several parameters separated by ':'.
+// Single or double quotes could be used to keep ',', '=', ':' or spaces in the
+// argument, inside quotes backslash escapes the quote character and itself:
+//
+//	sanitize:"path_clean,default='a, b',replace=old:new,regex_replace='^v([0-9]+)$':'version $1'"
+func parseSanitizeTag(tag string) ([]sanitizeAction, error) {
+	var actions []sanitizeAction
+	for pos := 0; pos < len(tag); pos++ {
+		start := pos
+		for pos < len(tag) && tag[pos] != '=' && tag[pos] != ',' {
+			pos++
+		}
+		name := strings.TrimSpace(tag[start:pos])
+		if len(name) == 0 {
+			if pos < len(tag) && tag[pos] == '=' {
+				return nil, fmt.Errorf("missing action name at position %d", pos)
+			}
+			continue // empty action, nothing to do
+		}
+		for i, c := range name {
+			if !(c == '_' || c == '-' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+				return nil, fmt.Errorf("unexpected character %q in action name '%s' at position %d", c, name, start+i)
+			}
+		}
+		action := sanitizeAction{name: name}
+		if pos < len(tag) && tag[pos] == '=' {
+			var err error
+			if action.args, pos, err = parseSanitizeArgs(tag, pos+1); err != nil {
+				return nil, fmt.Errorf("bad argument of '%s': %w", name, err)
+			}
+			action.arg = strings.Join(action.args, ":")
+		}
+		actions = append(actions, action)
+	}
+	return actions, nil
+}
+
+// parseSanitizeArgs parses action argument starting at pos till the end of action
+// and returns parsed parameters along with the position of terminating ','.
+func parseSanitizeArgs(tag string, pos int) ([]string, int, error) {
+	var (
+		args   []string
+		param  strings.Builder
+		quoted bool
+	)
+	finish := func() {
+		if quoted {
+			args = append(args, param.String())
+		} else {
+			// unquoted parameters do not keep surrounding spaces
+			args = append(args, strings.TrimSpace(param.String()))
+		}
+		param.Reset()
+		quoted = false
+	}
+	for ; pos < len(tag) && tag[pos] != ','; pos++ {
+		switch c := tag[pos]; c {
+		case '\'', '"':
+			if !quoted && len(strings.TrimSpace(param.String())) == 0 {
+				param.Reset() // spaces before opening quote are not part of parameter
+			}
+			start, closed := pos, false
+			for pos++; pos < len(tag); pos++ {
+				if tag[pos] == '\\' && pos+1 < len(tag) && (tag[pos+1] == c || tag[pos+1] == '\\') {
+					pos++
+				} else if tag[pos] == c {
+					closed = true
+					break
+				}
+				param.WriteByte(tag[pos])
+			}
+			if !closed {
+				return nil, pos, fmt.Errorf("unterminated quote started at position %d", start)
+			}
+			quoted = true
+		case ':':
+			finish()
+		default:
+			param.WriteByte(c)
+		}
+	}
+	finish()
+	return args, pos, nil
+}
@@ -1,8 +1,18 @@
 package gencfg
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"slices"
+	"strings"
 	"testing"
+	"time"
+
+	yaml "gopkg.in/yaml.v3"
 )
 
 // NOTE: not save for multiple concurrent tests!
@@ -110,3 +120,550 @@ func TestSanitize(t *testing.T) {
 	}
 	t.Logf("count=%d", count)
 }
+
+type configCustom struct {
+	Name  string            `yaml:"name" sanitize:"shout"`
+	Names []string          `yaml:"names" sanitize:"shout"`
+	Other map[string]string `yaml:"other" sanitize:"exclaim"`
+}
+
+func TestSanitizeCustom(t *testing.T) {
+	RegisterSanitizer("shout", func(ctx SanitizeContext, v reflect.Value, _ string) error {
+		v.SetString(strings.ToUpper(v.String()))
+		return nil
+	})
+	// do not leak test action into global registry
+	t.Cleanup(func() {
+		registryGuard.Lock()
+		defer registryGuard.Unlock()
+		delete(registry, "shout")
+	})
+	exclaim := func(ctx SanitizeContext, v reflect.Value, _ string) error {
+		v.SetString(v.String() + "!")
+		return nil
+	}
+
+	cfg := configCustom{Name: "a", Names: []string{"b", "c"}, Other: map[string]string{"k": "d"}}
+	if err := Sanitize(&cfg); err == nil {
+		t.Fatal("expected error for unknown sanitize tag")
+	}
+	if err := Sanitize(&cfg, WithSanitizer("exclaim", exclaim)); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Name != "A" || cfg.Names[0] != "B" || cfg.Names[1] != "C" || cfg.Other["k"] != "d!" {
+		t.Fatalf("unexpected result: %+v", cfg)
+	}
+}
+
+func TestParseSanitizeTag(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want []sanitizeAction
+		err  bool
+	}{
+		{tag: "path_clean, path_abs", want: []sanitizeAction{{name: "path_clean"}, {name: "path_abs"}}},
+		{tag: "default='a, b=c'", want: []sanitizeAction{{name: "default", arg: "a, b=c", args: []string{"a, b=c"}}}},
+		{tag: "replace=old:new,trim_prefix='a=b'", want: []sanitizeAction{
+			{name: "replace", arg: "old:new", args: []string{"old", "new"}},
+			{name: "trim_prefix", arg: "a=b", args: []string{"a=b"}},
+		}},
+		{tag: `regex_replace='(\d+):x':"\"$1\""`, want: []sanitizeAction{
+			{name: "regex_replace", arg: `(\d+):x:"$1"`, args: []string{`(\d+):x`, `"$1"`}},
+		}},
+		{tag: "default=", want: []sanitizeAction{{name: "default", args: []string{""}}}},
+		{tag: "default='abc", err: true},
+		{tag: "=abc", err: true},
+		{tag: "bad name", err: true},
+	}
+	for _, test := range tests {
+		got, err := parseSanitizeTag(test.tag)
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: expected error", test.tag)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.tag, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %+v, want %+v", test.tag, got, test.want)
+		}
+	}
+}
+
+type configReplace struct {
+	Empty   string `sanitize:"default='x, y'"`
+	Replace string `sanitize:"replace=':':'=',trim_prefix='a='"`
+	Regex   string `sanitize:"regex_replace='^v([0-9]+)$':'version $1'"`
+}
+
+func TestSanitizeArguments(t *testing.T) {
+	cfg := configReplace{Replace: "a:b:c", Regex: "v12"}
+	if err := Sanitize(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Empty != "x, y" || cfg.Replace != "b=c" || cfg.Regex != "version 12" {
+		t.Fatalf("unexpected result: %+v", cfg)
+	}
+
+	bad := struct {
+		Field string `sanitize:"replace=abc"`
+	}{}
+	if err := Sanitize(&bad); err == nil || !strings.Contains(err.Error(), "Field") {
+		t.Fatalf("expected error naming the field, got %v", err)
+	}
+}
+
+type configStrings struct {
+	Trim    string            `sanitize:"trim,lower"`
+	Cutset  string            `sanitize:"trim='/'"`
+	Upper   []string          `sanitize:"upper"`
+	Env     map[string]string `sanitize:"expand_env"`
+	Home    string            `sanitize:"expand_home"`
+	Quoted  []string          `sanitize:"unquote"`
+	Newline string            `sanitize:"normalize_newlines"`
+}
+
+func TestSanitizeStrings(t *testing.T) {
+	t.Setenv("GENCFG_TEST_VAR", "value")
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skip("no home directory")
+	}
+
+	cfg := configStrings{
+		Trim:    "  MiXeD \t",
+		Cutset:  "/dir/",
+		Upper:   []string{"a", "b"},
+		Env:     map[string]string{"k": "${GENCFG_TEST_VAR}/x"},
+		Home:    "~/data",
+		Quoted:  []string{`"a\tb"`, `'it''s'`, "`raw`", "plain"},
+		Newline: "a\r\nb\rc",
+	}
+	if err := Sanitize(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	want := configStrings{
+		Trim:    "mixed",
+		Cutset:  "dir",
+		Upper:   []string{"A", "B"},
+		Env:     map[string]string{"k": "value/x"},
+		Home:    home + "/data",
+		Quoted:  []string{"a\tb", "it's", "raw", "plain"},
+		Newline: "a\nb\nc",
+	}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Fatalf("got %+v, want %+v", cfg, want)
+	}
+}
+
+type configPaths struct {
+	Abs     string   `sanitize:"path_abs_root"`
+	Rel     string   `sanitize:"path_rel_to_root"`
+	Link    string   `sanitize:"path_eval_symlinks"`
+	Within  []string `sanitize:"path_within_root"`
+	Outside string   `sanitize:"path_within_root"`
+}
+
+func TestSanitizePaths(t *testing.T) {
+	base, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(base, "data"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("data", filepath.Join(base, "link")); err != nil {
+		t.Skip("symbolic links are not supported")
+	}
+
+	cfg := configPaths{
+		Abs:    "a/../b",
+		Rel:    filepath.Join(base, "x", "y"),
+		Link:   "link",
+		Within: []string{"data", filepath.Join(base, "x"), "a/../b"},
+	}
+	if err := Sanitize(&cfg, WithBaseDir(base)); err != nil {
+		t.Fatal(err)
+	}
+	want := configPaths{
+		Abs:    filepath.Join(base, "b"),
+		Rel:    filepath.Join("x", "y"),
+		Link:   filepath.Join(base, "data"),
+		Within: cfg.Within,
+	}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Fatalf("got %+v, want %+v", cfg, want)
+	}
+
+	cfg.Outside = "../escape"
+	if err := Sanitize(&cfg, WithBaseDir(base)); err == nil || !strings.Contains(err.Error(), "Outside") {
+		t.Fatalf("expected error for path outside of base directory, got %v", err)
+	}
+
+	// symbolic link inside of base directory pointing outside of it
+	if err := os.Symlink(t.TempDir(), filepath.Join(base, "escape")); err != nil {
+		t.Fatal(err)
+	}
+	for _, outside := range []string{"escape", filepath.Join("escape", "missing", "file")} {
+		cfg.Outside = outside
+		if err := Sanitize(&cfg, WithBaseDir(base)); err == nil || !strings.Contains(err.Error(), "Outside") {
+			t.Fatalf("expected error for symbolic link '%s' leading outside of base directory, got %v", outside, err)
+		}
+	}
+	cfg.Outside = filepath.Join("link", "missing")
+	if err := Sanitize(&cfg, WithBaseDir(base)); err != nil {
+		t.Fatalf("unexpected error for symbolic link within base directory: %v", err)
+	}
+}
+
+type configNumbers struct {
+	Port     int           `yaml:"port" sanitize:"clamp=1:65535"`
+	Workers  uint          `yaml:"workers" sanitize:"default=4,clamp=:2"`
+	Ratio    float64       `yaml:"ratio" sanitize:"round_to=0.25"`
+	Timeout  time.Duration `yaml:"timeout" sanitize:"default=30s,round_to=1s"`
+	Interval time.Duration `yaml:"interval" sanitize:"round_to=1m"`
+	Limit    ByteSize      `yaml:"limit" sanitize:"clamp=1KiB:1GiB"`
+	Size     ByteSize      `yaml:"size" sanitize:"default=10MiB"`
+	Enabled  bool          `yaml:"enabled" sanitize:"default=true"`
+	Offset   int64         `yaml:"offset" sanitize:"round_to=10"`
+}
+
+func TestSanitizeNumbers(t *testing.T) {
+	var cfg configNumbers
+	data := "port: 70000\nratio: 1.13\ninterval: 90s\nlimit: 10GB\noffset: -15\n"
+	if err := yaml.Unmarshal([]byte(data), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := Sanitize(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	want := configNumbers{
+		Port:     65535,
+		Workers:  2,
+		Ratio:    1.25,
+		Timeout:  30 * time.Second,
+		Interval: 2 * time.Minute,
+		Limit:    GiB,
+		Size:     10 * MiB,
+		Enabled:  true,
+		Offset:   -20,
+	}
+	if cfg != want {
+		t.Fatalf("got %+v, want %+v", cfg, want)
+	}
+
+	bad := struct {
+		Name string `sanitize:"clamp=1:2"`
+	}{}
+	if err := Sanitize(&bad); err == nil {
+		t.Fatal("expected error for clamp on string")
+	}
+	inverted := struct {
+		Port int `sanitize:"clamp=100:1"`
+	}{}
+	if err := Sanitize(&inverted); err == nil || !strings.Contains(err.Error(), "min is greater than max") {
+		t.Fatalf("expected error for inverted clamp range, got %v", err)
+	}
+}
+
+func TestSanitizeCollectionDefault(t *testing.T) {
+	cfg := struct {
+		Hosts  []string          `sanitize:"default='a,b',upper"`
+		Empty  []string          `sanitize:"default=x"`
+		Set    []string          `sanitize:"default=x,trim"`
+		Labels map[string]string `sanitize:"default='k=v',upper"`
+	}{Empty: []string{}, Set: []string{" y ", ""}}
+	if err := Sanitize(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	// default is applied to the empty collection, not to its elements
+	if !slices.Equal(cfg.Hosts, []string{"A", "B"}) || !slices.Equal(cfg.Empty, []string{"x"}) || !slices.Equal(cfg.Set, []string{"y", ""}) {
+		t.Fatalf("unexpected slices: %v %v %v", cfg.Hosts, cfg.Empty, cfg.Set)
+	}
+	if !reflect.DeepEqual(cfg.Labels, map[string]string{"k": "V"}) {
+		t.Fatalf("unexpected map: %v", cfg.Labels)
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	tests := map[string]int64{
+		"512":    512,
+		"1k":     1024,
+		"64KB":   64000,
+		"10MiB":  10 << 20,
+		"1.5 G":  3 << 29,
+		"2tib":   2 << 40,
+		" 7 b ":  7,
+		"0.5KiB": 512,
+	}
+	for in, want := range tests {
+		got, err := ParseByteSize(in)
+		if err != nil || got != want {
+			t.Errorf("%q: got %d (%v), want %d", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "MiB", "10XB", "-1"} {
+		if _, err := ParseByteSize(in); err == nil {
+			t.Errorf("%q: expected error", in)
+		}
+	}
+	if s := (3 * MiB).String(); s != "3MiB" {
+		t.Errorf("got %s, want 3MiB", s)
+	}
+}
+
+type configDirs struct {
+	Dir  string `sanitize:"path_abs_root,assure_dir_exists"`
+	Log  string `sanitize:"path_abs_root,assure_dir_exists_for_file"`
+	File string `sanitize:"path_abs_root,assure_file_access"`
+}
+
+func TestSanitizeDryRun(t *testing.T) {
+	base := t.TempDir()
+	cfg := configDirs{Dir: "a/b", Log: "logs/app.log", File: "missing.txt"}
+
+	var effects []SanitizeEffect
+	if err := Sanitize(&cfg, WithBaseDir(base), WithDryRun(), WithEffects(&effects)); err != nil {
+		t.Fatal(err)
+	}
+	want := []SanitizeEffect{
+		{Action: EffectMkdir, Path: filepath.Join(base, "a", "b"), Field: "Dir"},
+		{Action: EffectMkdir, Path: filepath.Join(base, "logs"), Field: "Log"},
+		{Action: EffectAccess, Path: filepath.Join(base, "missing.txt"), Field: "File"},
+	}
+	if !reflect.DeepEqual(effects, want) {
+		t.Fatalf("got %+v, want %+v", effects, want)
+	}
+	if entries, _ := os.ReadDir(base); len(entries) != 0 {
+		t.Fatalf("dry run created %d entries", len(entries))
+	}
+
+	cfg.File = ""
+	if err := Sanitize(&cfg, WithBaseDir(base), WithDirMode(0700)); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(filepath.Join(base, "a", "b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0700 {
+		t.Fatalf("got mode %v, want 0700", info.Mode().Perm())
+	}
+}
+
+type configAccess struct {
+	Secret string `sanitize:"path_abs_root,assure_is_file,assure_readable,assure_mode=0600"`
+	Dir    string `sanitize:"assure_is_dir,assure_writable,assure_executable"`
+}
+
+func TestSanitizeAccess(t *testing.T) {
+	base := t.TempDir()
+	secret := filepath.Join(base, "secret")
+	if err := os.WriteFile(secret, []byte("pass"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := configAccess{Secret: "secret", Dir: base}
+	if err := Sanitize(&cfg, WithBaseDir(base)); err != nil {
+		t.Fatal(err)
+	}
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+	if err := os.Chmod(secret, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Sanitize(&cfg, WithBaseDir(base)); err == nil || !strings.Contains(err.Error(), "Secret") {
+		t.Fatalf("expected error for loose permissions, got %v", err)
+	}
+	cfg = configAccess{Secret: secret, Dir: secret}
+	if err := Sanitize(&cfg, WithSanitizer("assure_mode", func(SanitizeContext, reflect.Value, string) error { return nil })); err == nil || !strings.Contains(err.Error(), "not a directory") {
+		t.Fatalf("expected error for file instead of directory, got %v", err)
+	}
+}
+
+type logLevel string
+
+func (l *logLevel) Sanitize(ctx SanitizeContext) error {
+	switch level := logLevel(strings.ToLower(string(*l))); level {
+	case "debug", "info", "error":
+		*l = level
+		return nil
+	}
+	return fmt.Errorf("bad log level '%s' for '%s'", *l, ctx.Name)
+}
+
+type endpoint struct {
+	Host string `sanitize:"trim"`
+	Port int
+}
+
+func (e *endpoint) Sanitize(SanitizeContext) error {
+	if e.Port == 0 {
+		e.Port = 80
+	}
+	return nil
+}
+
+type configSelf struct {
+	Level     logLevel            `sanitize:"trim"`
+	Levels    []logLevel          `sanitize:"upper"`
+	Main      endpoint            `yaml:"main"`
+	Optional  *endpoint           `yaml:"optional"`
+	Endpoints map[string]endpoint `yaml:"endpoints"`
+}
+
+func TestSanitizeInterface(t *testing.T) {
+	cfg := configSelf{
+		Level:     " Info ",
+		Levels:    []logLevel{"debug", "Error"},
+		Main:      endpoint{Host: " main "},
+		Optional:  &endpoint{Port: 8080},
+		Endpoints: map[string]endpoint{"eu": {Host: "eu "}},
+	}
+	if err := Sanitize(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	want := configSelf{
+		Level:     "info",
+		Levels:    []logLevel{"debug", "error"},
+		Main:      endpoint{Host: "main", Port: 80},
+		Optional:  &endpoint{Port: 8080},
+		Endpoints: map[string]endpoint{"eu": {Host: "eu", Port: 80}},
+	}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Fatalf("got %+v, want %+v", cfg, want)
+	}
+
+	cfg.Levels = []logLevel{"verbose"}
+	if err := Sanitize(&cfg); err == nil {
+		t.Fatal("expected error for bad log level")
+	}
+}
+
+type tlsConfig struct {
+	CertFile string `sanitize:"path_within_root"`
+}
+
+type serverConfig struct {
+	TLS tlsConfig
+}
+
+type backendConfig struct {
+	Dir string `sanitize:"path_within_root"`
+}
+
+type configErrors struct {
+	Servers  map[string]*serverConfig
+	Backends []backendConfig
+	Port     string `sanitize:"clamp=1:2"`
+}
+
+func TestSanitizeErrors(t *testing.T) {
+	cfg := configErrors{
+		Servers:  map[string]*serverConfig{"eu": {TLS: tlsConfig{CertFile: "../cert.pem"}}, "us": {}},
+		Backends: []backendConfig{{Dir: "data"}, {Dir: "../../data"}},
+	}
+	err := Sanitize(&cfg, WithBaseDir(t.TempDir()))
+	if err == nil {
+		t.Fatal("expected errors")
+	}
+
+	var paths []string
+	for _, e := range err.(interface{ Unwrap() []error }).Unwrap() {
+		var serr *SanitizeError
+		if !errors.As(e, &serr) {
+			t.Fatalf("unexpected error type %T: %v", e, e)
+		}
+		paths = append(paths, serr.Path+"/"+serr.Tag)
+	}
+	want := []string{`Servers["eu"].TLS.CertFile/path_within_root`, "Backends[1].Dir/path_within_root", "Port/clamp"}
+	if !reflect.DeepEqual(paths, want) {
+		t.Fatalf("got %v, want %v", paths, want)
+	}
+}
+
+type Common struct {
+	Name string
+	Dir  string `sanitize:"path_clean"`
+}
+
+type configEmbedded struct {
+	Common `sanitize:"trim"`
+	Any    any               `sanitize:"upper"`
+	Items  []any             `sanitize:"trim"`
+	Nested any               `yaml:"nested"`
+	Paths  map[string]string `sanitize:"keys='trim,path_clean',path_clean"`
+}
+
+func TestSanitizeEmbeddedInterfacesKeys(t *testing.T) {
+	b := " b "
+	cfg := configEmbedded{
+		Common: Common{Name: " name ", Dir: " a/../b "},
+		Any:    "any",
+		Items:  []any{" a ", &b},
+		Nested: &endpoint{Host: " nested "},
+		Paths:  map[string]string{" a/../x ": "y/./z", "k": "v"},
+	}
+	if err := Sanitize(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	// own tag of the promoted field takes precedence over inherited one
+	if cfg.Name != "name" || cfg.Dir != "b " {
+		t.Fatalf("unexpected embedded fields: %+v", cfg.Common)
+	}
+	if cfg.Any != "ANY" || cfg.Items[0] != "a" || *cfg.Items[1].(*string) != "b" {
+		t.Fatalf("unexpected interface fields: %v %v", cfg.Any, cfg.Items)
+	}
+	if e := cfg.Nested.(*endpoint); e.Host != "nested" || e.Port != 80 {
+		t.Fatalf("unexpected nested value: %+v", e)
+	}
+	if want := map[string]string{"x": "y/z", "k": "v"}; !reflect.DeepEqual(cfg.Paths, want) {
+		t.Fatalf("got %v, want %v", cfg.Paths, want)
+	}
+
+	cfg.Paths = map[string]string{"x": "1", "./x": "2"}
+	err := Sanitize(&cfg)
+	var serr *SanitizeError
+	if !errors.As(err, &serr) || serr.Tag != "keys" || serr.Path != `Paths["x"]` {
+		t.Fatalf("expected keys collision error, got %v", err)
+	}
+	if len(cfg.Paths) != 2 {
+		t.Fatalf("map should not be re-keyed on error: %v", cfg.Paths)
+	}
+
+	bad := struct {
+		Embedded Common `sanitize:"keys=trim"`
+		Value    string `sanitize:"keys=trim"`
+	}{}
+	if err := Sanitize(&bad); err == nil || !strings.Contains(err.Error(), "only works on maps") {
+		t.Fatalf("expected error for keys on non map field, got %v", err)
+	}
+}
+
+type Counter struct {
+	Calls int
+}
+
+func (c *Counter) Sanitize(SanitizeContext) error {
+	c.Calls++
+	return nil
+}
+
+func TestSanitizeEmbeddedSanitizer(t *testing.T) {
+	cfg := struct {
+		Counter
+		Ptr *struct{ *Counter }
+	}{Ptr: &struct{ *Counter }{&Counter{}}}
+	if err := Sanitize(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	// promoted method must not be called again for the embedded structure
+	if cfg.Calls != 1 || cfg.Ptr.Calls != 1 {
+		t.Fatalf("unexpected number of calls: %d %d", cfg.Calls, cfg.Ptr.Calls)
+	}
+}
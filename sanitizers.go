@@ -0,0 +1,535 @@
+package gencfg
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// stringValue returns value of the field for sanitize actions which only work on strings.
+func stringValue(ctx SanitizeContext, v reflect.Value) (string, error) {
+	if v.Kind() != reflect.String {
+		return "", fmt.Errorf("sanitize tag '%s' on '%s' only works on strings", ctx.Tag, ctx.Name)
+	}
+	return v.String(), nil
+}
+
+func sanitizePathClean(ctx SanitizeContext, v reflect.Value, _ string) error {
+	path, err := stringValue(ctx, v)
+	if err != nil || len(path) == 0 {
+		return err
+	}
+	v.SetString(filepath.Clean(path))
+	return nil
+}
+
+func sanitizePathAbs(ctx SanitizeContext, v reflect.Value, _ string) error {
+	path, err := stringValue(ctx, v)
+	if err != nil || len(path) == 0 {
+		return err
+	}
+	apath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path for '%s': %w", path, err)
+	}
+	v.SetString(apath)
+	return nil
+}
+
+func sanitizePathToSlash(ctx SanitizeContext, v reflect.Value, _ string) error {
+	path, err := stringValue(ctx, v)
+	if err != nil || len(path) == 0 {
+		return err
+	}
+	v.SetString(filepath.ToSlash(path))
+	return nil
+}
+
+func sanitizePathAbsRoot(ctx SanitizeContext, v reflect.Value, _ string) error {
+	path, err := stringValue(ctx, v)
+	if err != nil || len(path) == 0 {
+		return err
+	}
+	v.SetString(ctx.resolve(path))
+	return nil
+}
+
+func sanitizePathRelToRoot(ctx SanitizeContext, v reflect.Value, _ string) error {
+	path, err := stringValue(ctx, v)
+	if err != nil || len(path) == 0 {
+		return err
+	}
+	rpath, err := filepath.Rel(ctx.BaseDir(), ctx.resolve(path))
+	if err != nil {
+		return fmt.Errorf("failed to get path relative to '%s' for '%s': %w", ctx.BaseDir(), path, err)
+	}
+	v.SetString(rpath)
+	return nil
+}
+
+func sanitizePathEvalSymlinks(ctx SanitizeContext, v reflect.Value, _ string) error {
+	path, err := stringValue(ctx, v)
+	if err != nil || len(path) == 0 {
+		return err
+	}
+	epath, err := filepath.EvalSymlinks(ctx.resolve(path))
+	if err != nil {
+		return fmt.Errorf("failed to evaluate symbolic links for '%s': %w", path, err)
+	}
+	v.SetString(epath)
+	return nil
+}
+
+func sanitizePathWithinRoot(ctx SanitizeContext, v reflect.Value, _ string) error {
+	path, err := stringValue(ctx, v)
+	if err != nil || len(path) == 0 {
+		return err
+	}
+	base, resolved := ctx.BaseDir(), ctx.resolve(path)
+	// symbolic links inside of base directory could point outside of it
+	if !isWithin(base, resolved) || !isWithin(evalExistingSymlinks(base), evalExistingSymlinks(resolved)) {
+		return fmt.Errorf("path '%s' of '%s' is outside of '%s'", path, ctx.Name, base)
+	}
+	return nil
+}
+
+// isWithin reports if path is inside of base directory, both paths are compared as strings.
+func isWithin(base, path string) bool {
+	rpath, err := filepath.Rel(base, path)
+	return err == nil && rpath != ".." && !strings.HasPrefix(rpath, ".."+string(filepath.Separator))
+}
+
+// evalExistingSymlinks evaluates symbolic links in the longest existing part of the path,
+// the rest of the path (which does not exist yet) is appended as is.
+func evalExistingSymlinks(path string) string {
+	rest := ""
+	for p := path; ; {
+		if epath, err := filepath.EvalSymlinks(p); err == nil {
+			return filepath.Join(epath, rest)
+		}
+		parent := filepath.Dir(p)
+		if parent == p {
+			return path
+		}
+		rest = filepath.Join(filepath.Base(p), rest)
+		p = parent
+	}
+}
+
+func sanitizeAssureDirExists(ctx SanitizeContext, v reflect.Value, _ string) error {
+	dir, err := stringValue(ctx, v)
+	if err != nil || len(dir) == 0 {
+		return err
+	}
+	if err := ctx.mkdirAll(dir); err != nil {
+		return fmt.Errorf("failed to create directory '%s': %w", dir, err)
+	}
+	return nil
+}
+
+func sanitizeAssureDirExistsForFile(ctx SanitizeContext, v reflect.Value, _ string) error {
+	path, err := stringValue(ctx, v)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(path)
+	if len(dir) == 0 {
+		return nil
+	}
+	if err := ctx.mkdirAll(dir); err != nil {
+		return fmt.Errorf("failed to create directory '%s': %w", dir, err)
+	}
+	return nil
+}
+
+func sanitizeAssureFileAccess(ctx SanitizeContext, v reflect.Value, _ string) error {
+	name, err := stringValue(ctx, v)
+	if err != nil || len(name) == 0 {
+		return err
+	}
+	fileName, err := filepath.Abs(name)
+	if err != nil {
+		return fmt.Errorf("wrong file name '%s': %w", name, err)
+	}
+	if !ctx.access(fileName) {
+		return nil
+	}
+	if _, err := os.Stat(fileName); err != nil {
+		return fmt.Errorf("file '%s' does not exists or is not accessible: %w", fileName, err)
+	}
+	return nil
+}
+
+// transformString makes sanitize action out of a simple string transformation.
+func transformString(transform func(string) string) SanitizerFunc {
+	return func(ctx SanitizeContext, v reflect.Value, _ string) error {
+		value, err := stringValue(ctx, v)
+		if err != nil {
+			return err
+		}
+		v.SetString(transform(value))
+		return nil
+	}
+}
+
+// normalizeNewlines converts Windows and old Mac line endings to '\n'.
+func normalizeNewlines(value string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(value, "\r\n", "\n"), "\r", "\n")
+}
+
+func sanitizeTrim(ctx SanitizeContext, v reflect.Value, arg string) error {
+	value, err := stringValue(ctx, v)
+	if err != nil {
+		return err
+	}
+	if len(arg) == 0 {
+		v.SetString(strings.TrimSpace(value))
+	} else {
+		v.SetString(strings.Trim(value, arg))
+	}
+	return nil
+}
+
+func sanitizeExpandHome(ctx SanitizeContext, v reflect.Value, _ string) error {
+	path, err := stringValue(ctx, v)
+	if err != nil {
+		return err
+	}
+	if path != "~" && !strings.HasPrefix(path, "~/") && !strings.HasPrefix(path, "~"+string(filepath.Separator)) {
+		return nil // "~user" form is not supported
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return fmt.Errorf("unable to expand home directory for '%s': %w", ctx.Name, err)
+	}
+	v.SetString(home + path[1:])
+	return nil
+}
+
+func sanitizeUnquote(ctx SanitizeContext, v reflect.Value, _ string) error {
+	value, err := stringValue(ctx, v)
+	if err != nil {
+		return err
+	}
+	if len(value) < 2 || value[0] != value[len(value)-1] {
+		return nil
+	}
+	switch value[0] {
+	case '"':
+		unquoted, err := strconv.Unquote(value)
+		if err != nil {
+			return fmt.Errorf("unable to unquote value of '%s': %w", ctx.Name, err)
+		}
+		v.SetString(unquoted)
+	case '\'':
+		// YAML style - single quote is escaped by doubling it
+		v.SetString(strings.ReplaceAll(value[1:len(value)-1], "''", "'"))
+	case '`':
+		v.SetString(value[1 : len(value)-1])
+	}
+	return nil
+}
+
+// requireArgs checks number of parameters passed to sanitize action.
+func requireArgs(ctx SanitizeContext, n int) error {
+	if len(ctx.Args) != n {
+		return fmt.Errorf("sanitize tag '%s' on '%s' expects %d parameter(s), got %d", ctx.Tag, ctx.Name, n, len(ctx.Args))
+	}
+	return nil
+}
+
+// numberValue checks that value is numeric for sanitize actions which only work on numbers.
+func numberValue(ctx SanitizeContext, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return nil
+	}
+	return fmt.Errorf("sanitize tag '%s' on '%s' only works on numbers and durations", ctx.Tag, ctx.Name)
+}
+
+// compareNumbers compares two numeric values of the same type returning -1, 0 or 1.
+func compareNumbers(a, b reflect.Value) int {
+	switch a.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return cmp.Compare(a.Int(), b.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return cmp.Compare(a.Uint(), b.Uint())
+	default:
+		return cmp.Compare(a.Float(), b.Float())
+	}
+}
+
+func sanitizeDefault(ctx SanitizeContext, v reflect.Value, arg string) error {
+	if !v.IsZero() {
+		return nil
+	}
+	if err := setFromString(v, arg); err != nil {
+		return fmt.Errorf("sanitize tag '%s' on '%s' has bad value '%s': %w", ctx.Tag, ctx.Name, arg, err)
+	}
+	return nil
+}
+
+func sanitizeClamp(ctx SanitizeContext, v reflect.Value, arg string) error {
+	if err := numberValue(ctx, v); err != nil {
+		return err
+	}
+	if err := requireArgs(ctx, 2); err != nil {
+		return err
+	}
+	// either bound could be omitted: "clamp=1:" or "clamp=:100"
+	var bounds [2]reflect.Value
+	for i, barg := range ctx.Args {
+		if len(barg) == 0 {
+			continue
+		}
+		bound, err := parseAs(v, barg)
+		if err != nil {
+			return fmt.Errorf("sanitize tag '%s' on '%s' has bad bound '%s': %w", ctx.Tag, ctx.Name, barg, err)
+		}
+		bounds[i] = bound
+	}
+	if bounds[0].IsValid() && bounds[1].IsValid() && compareNumbers(bounds[0], bounds[1]) > 0 {
+		return fmt.Errorf("sanitize tag '%s' on '%s' has bad range '%s': min is greater than max", ctx.Tag, ctx.Name, arg)
+	}
+	if bounds[0].IsValid() && compareNumbers(v, bounds[0]) < 0 {
+		v.Set(bounds[0])
+	}
+	if bounds[1].IsValid() && compareNumbers(v, bounds[1]) > 0 {
+		v.Set(bounds[1])
+	}
+	return nil
+}
+
+func sanitizeRoundTo(ctx SanitizeContext, v reflect.Value, arg string) error {
+	if err := numberValue(ctx, v); err != nil {
+		return err
+	}
+	if err := requireArgs(ctx, 1); err != nil {
+		return err
+	}
+	unit, err := parseAs(v, arg)
+	if err != nil || unit.IsZero() {
+		return fmt.Errorf("sanitize tag '%s' on '%s' has bad value '%s': must be non zero number", ctx.Tag, ctx.Name, arg)
+	}
+	// rounding half away from zero, the same way time.Duration.Round does
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		x, n := v.Int(), unit.Int()
+		if n < 0 {
+			n = -n
+		}
+		q, r := x/n, x%n
+		if r < 0 {
+			r = -r
+		}
+		if r >= n-r {
+			if x < 0 {
+				q--
+			} else {
+				q++
+			}
+		}
+		v.SetInt(q * n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		x, n := v.Uint(), unit.Uint()
+		q := x / n
+		if x%n >= n-x%n {
+			q++
+		}
+		v.SetUint(q * n)
+	default:
+		v.SetFloat(math.Round(v.Float()/unit.Float()) * unit.Float())
+	}
+	return nil
+}
+
+func sanitizeReplace(ctx SanitizeContext, v reflect.Value, _ string) error {
+	value, err := stringValue(ctx, v)
+	if err != nil {
+		return err
+	}
+	if err := requireArgs(ctx, 2); err != nil {
+		return err
+	}
+	v.SetString(strings.ReplaceAll(value, ctx.Args[0], ctx.Args[1]))
+	return nil
+}
+
+func sanitizeRegexReplace(ctx SanitizeContext, v reflect.Value, _ string) error {
+	value, err := stringValue(ctx, v)
+	if err != nil {
+		return err
+	}
+	if err := requireArgs(ctx, 2); err != nil {
+		return err
+	}
+	re, err := regexp.Compile(ctx.Args[0])
+	if err != nil {
+		return fmt.Errorf("sanitize tag '%s' on '%s' has bad regular expression: %w", ctx.Tag, ctx.Name, err)
+	}
+	v.SetString(re.ReplaceAllString(value, ctx.Args[1]))
+	return nil
+}
+
+func sanitizeTrimPrefix(ctx SanitizeContext, v reflect.Value, arg string) error {
+	value, err := stringValue(ctx, v)
+	if err != nil {
+		return err
+	}
+	v.SetString(strings.TrimPrefix(value, arg))
+	return nil
+}
+
+func sanitizeTrimSuffix(ctx SanitizeContext, v reflect.Value, arg string) error {
+	value, err := stringValue(ctx, v)
+	if err != nil {
+		return err
+	}
+	v.SetString(strings.TrimSuffix(value, arg))
+	return nil
+}
+
+// accessMode is a set of access rights to check, values are the same as used by access(2).
+type accessMode uint32
+
+const (
+	accessExecute accessMode = 1 << iota
+	accessWrite
+	accessRead
+)
+
+// statPath resolves field value against base directory and gets information about the file,
+// nil information without error is returned when field is empty or in dry-run mode.
+func statPath(ctx SanitizeContext, v reflect.Value) (string, os.FileInfo, error) {
+	name, err := stringValue(ctx, v)
+	if err != nil || len(name) == 0 {
+		return "", nil, err
+	}
+	path := ctx.resolve(name)
+	if !ctx.access(path) {
+		return path, nil, nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return path, nil, fmt.Errorf("'%s' of '%s' does not exist or is not accessible: %w", path, ctx.Name, err)
+	}
+	return path, info, nil
+}
+
+// assureAccess makes sanitize action checking access rights to the file.
+func assureAccess(mode accessMode, what string) SanitizerFunc {
+	return func(ctx SanitizeContext, v reflect.Value, _ string) error {
+		path, info, err := statPath(ctx, v)
+		if err != nil || info == nil {
+			return err
+		}
+		if err := checkAccess(path, info, mode); err != nil {
+			return fmt.Errorf("'%s' of '%s' is not %s: %w", path, ctx.Name, what, err)
+		}
+		return nil
+	}
+}
+
+func sanitizeAssureIsFile(ctx SanitizeContext, v reflect.Value, _ string) error {
+	path, info, err := statPath(ctx, v)
+	if err != nil || info == nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("'%s' of '%s' is not a regular file", path, ctx.Name)
+	}
+	return nil
+}
+
+func sanitizeAssureIsDir(ctx SanitizeContext, v reflect.Value, _ string) error {
+	path, info, err := statPath(ctx, v)
+	if err != nil || info == nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("'%s' of '%s' is not a directory", path, ctx.Name)
+	}
+	return nil
+}
+
+func sanitizeAssureMode(ctx SanitizeContext, v reflect.Value, arg string) error {
+	if err := requireArgs(ctx, 1); err != nil {
+		return err
+	}
+	allowed, err := strconv.ParseUint(arg, 8, 32)
+	if err != nil || allowed > 0777 {
+		return fmt.Errorf("sanitize tag '%s' on '%s' has bad mode '%s': must be octal permissions", ctx.Tag, ctx.Name, arg)
+	}
+	path, info, err := statPath(ctx, v)
+	if err != nil || info == nil {
+		return err
+	}
+	if err := checkMode(info, os.FileMode(allowed)); err != nil {
+		return fmt.Errorf("'%s' of '%s' has wrong permissions: %w", path, ctx.Name, err)
+	}
+	return nil
+}
+
+func sanitizeAssureOwner(ctx SanitizeContext, v reflect.Value, arg string) error {
+	if err := requireArgs(ctx, 1); err != nil {
+		return err
+	}
+	path, info, err := statPath(ctx, v)
+	if err != nil || info == nil {
+		return err
+	}
+	if err := checkOwner(info, arg); err != nil {
+		return fmt.Errorf("'%s' of '%s' has wrong owner: %w", path, ctx.Name, err)
+	}
+	return nil
+}
+
+// sanitizeTestFunctions only used by Sanitize tests and should never be invoked otherwise.
+type sanitizeTestFunctions struct{}
+
+// ReportTestCall is a test function that could be called by the sanitize function with the tag sanitize:"test_call=ReportTestCall".
+// Add more test methods with the same signature to sanitizeTestFunctions as needed.
+func (sanitizeTestFunctions) ReportTestCall(name, data string) error {
+	fmt.Println("ReportTestCall called with", name, data)
+	return nil
+}
+
+func (s sanitizeTestFunctions) invokeMethodByName(methodName, paramName, paramValue string) error {
+	method := reflect.ValueOf(s).MethodByName(methodName)
+	if !method.IsValid() {
+		return fmt.Errorf("function '%s' not found for '%s', value='%s'", methodName, paramName, paramValue)
+	}
+	res := method.Call([]reflect.Value{reflect.ValueOf(paramName), reflect.ValueOf(paramValue)})
+	if len(res) > 0 && !res[0].IsNil() {
+		return res[0].Interface().(error)
+	}
+	return nil
+}
+
+func sanitizeTestCall(ctx SanitizeContext, v reflect.Value, arg string) error {
+	// should only be used in testing environment
+	if !testing.Testing() {
+		return nil
+	}
+	data, err := stringValue(ctx, v)
+	if err != nil {
+		return err
+	}
+	if len(arg) == 0 {
+		return fmt.Errorf("empty test_call on '%s', must be test_call=function", ctx.Name)
+	}
+	testFunctions := sanitizeTestFunctions{}
+	if err := testFunctions.invokeMethodByName(arg, ctx.Name, data); err != nil {
+		return fmt.Errorf("failed to test_call: %w", err)
+	}
+	return nil
+}
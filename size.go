@@ -0,0 +1,114 @@
+package gencfg
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// ByteSize is a number of bytes which could be specified in configuration in
+// human readable form, for example "512", "64KB", "10MiB" or "1.5G".
+type ByteSize int64
+
+const (
+	KiB ByteSize = 1 << (10 * (iota + 1))
+	MiB
+	GiB
+	TiB
+	PiB
+)
+
+// byteSizeUnits maps lower case unit suffixes to multipliers. Decimal units (KB, MB...)
+// are powers of 1000, binary ones (KiB, MiB...) and single letters (K, M...) are powers of 1024.
+var byteSizeUnits = map[string]float64{
+	"":    1,
+	"b":   1,
+	"k":   float64(KiB),
+	"kb":  1e3,
+	"kib": float64(KiB),
+	"m":   float64(MiB),
+	"mb":  1e6,
+	"mib": float64(MiB),
+	"g":   float64(GiB),
+	"gb":  1e9,
+	"gib": float64(GiB),
+	"t":   float64(TiB),
+	"tb":  1e12,
+	"tib": float64(TiB),
+	"p":   float64(PiB),
+	"pb":  1e15,
+	"pib": float64(PiB),
+}
+
+// ParseByteSize parses human readable size, for example "10MiB", into number of bytes.
+func ParseByteSize(s string) (int64, error) {
+	str := strings.TrimSpace(s)
+	i := 0
+	for i < len(str) && (str[i] >= '0' && str[i] <= '9' || str[i] == '.') {
+		i++
+	}
+	if i == 0 {
+		return 0, fmt.Errorf("invalid size '%s'", s)
+	}
+	number, err := strconv.ParseFloat(str[:i], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size '%s': %w", s, err)
+	}
+	multiplier, ok := byteSizeUnits[strings.ToLower(strings.TrimSpace(str[i:]))]
+	if !ok {
+		return 0, fmt.Errorf("invalid size '%s': unknown unit '%s'", s, strings.TrimSpace(str[i:]))
+	}
+	size := number * multiplier
+	if size > math.MaxInt64 {
+		return 0, fmt.Errorf("invalid size '%s': value is out of range", s)
+	}
+	return int64(size), nil
+}
+
+// String formats size using the largest binary unit which represents it exactly.
+func (b ByteSize) String() string {
+	units := []struct {
+		size ByteSize
+		name string
+	}{{PiB, "PiB"}, {TiB, "TiB"}, {GiB, "GiB"}, {MiB, "MiB"}, {KiB, "KiB"}}
+	for _, unit := range units {
+		if b != 0 && b%unit.size == 0 {
+			return strconv.FormatInt(int64(b/unit.size), 10) + unit.name
+		}
+	}
+	return strconv.FormatInt(int64(b), 10)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (b *ByteSize) UnmarshalText(text []byte) error {
+	size, err := ParseByteSize(string(text))
+	if err != nil {
+		return err
+	}
+	*b = ByteSize(size)
+	return nil
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (b ByteSize) MarshalText() ([]byte, error) {
+	return []byte(b.String()), nil
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (b *ByteSize) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind != yaml.ScalarNode {
+		return fmt.Errorf("line %d: size must be a scalar value", value.Line)
+	}
+	if err := b.UnmarshalText([]byte(value.Value)); err != nil {
+		return fmt.Errorf("line %d: %w", value.Line, err)
+	}
+	return nil
+}
+
+// MarshalYAML implements yaml.Marshaler.
+func (b ByteSize) MarshalYAML() (any, error) {
+	return b.String(), nil
+}
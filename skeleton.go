@@ -0,0 +1,413 @@
+package gencfg
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// SkeletonOptions holds options for generating configuration template skeleton.
+type SkeletonOptions struct {
+	pkgDir string
+}
+
+// WithPackageDir sets directory of Go package where configuration structures are defined,
+// doc comments of structures and fields from its sources become YAML comments.
+func WithPackageDir(dir string) func(*SkeletonOptions) {
+	return func(opts *SkeletonOptions) {
+		opts.pkgDir = dir
+	}
+}
+
+// skeletonKind is a kind of YAML node generated for the field.
+type skeletonKind int
+
+const (
+	skeletonScalar skeletonKind = iota
+	skeletonStruct
+	skeletonSequence
+	skeletonMapping
+)
+
+// skeletonNode describes configuration field (or structure) independently of the source
+// it was obtained from - Go type or package sources.
+type skeletonNode struct {
+	kind skeletonKind
+	// name is the YAML key of the field
+	name string
+	// doc is the doc comment of the field
+	doc string
+	// validate is the value of "validate" tag
+	validate string
+	// value is the value of "default" tag or zero value placeholder for scalars
+	value string
+	// str is set when scalar value must stay a string in YAML
+	str bool
+	// hasDefault is set when value came from "default" tag
+	hasDefault bool
+	// fields of the structure, for sequences and mappings - fields of the element structure
+	fields []*skeletonNode
+	// elem is the element of sequence or mapping
+	elem *skeletonNode
+}
+
+// Skeleton generates commented YAML configuration template skeleton from configuration
+// structure cfg (structure or pointer to it). YAML keys are taken from "yaml" tags, values
+// from "default" tags (zero values are used when there are none) and "validate" rules are
+// noted in comments. When WithPackageDir is specified doc comments become comments as well.
+func Skeleton(cfg any, options ...func(*SkeletonOptions)) ([]byte, error) {
+	opts := &SkeletonOptions{}
+	for _, setOpt := range options {
+		setOpt(opts)
+	}
+
+	t := reflect.TypeOf(cfg)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("skeleton expected struct or pointer to struct, got %v", t)
+	}
+
+	pkg := &packageDocs{}
+	if len(opts.pkgDir) > 0 {
+		var err error
+		if pkg, err = parsePackage(opts.pkgDir); err != nil {
+			return nil, err
+		}
+	}
+	b := &typeSkeleton{docs: pkg, visiting: make(map[reflect.Type]bool)}
+	return renderSkeleton(b.node(t), pkg.types[t.Name()].doc)
+}
+
+// SkeletonFromPackage generates configuration template skeleton the same way Skeleton does,
+// but using Go sources of the package in dir rather than type information. This allows
+// to generate skeleton without compiling the code, typeName is the name of configuration structure.
+func SkeletonFromPackage(dir, typeName string) ([]byte, error) {
+	pkg, err := parsePackage(dir)
+	if err != nil {
+		return nil, err
+	}
+	decl, ok := pkg.types[typeName]
+	if !ok {
+		return nil, fmt.Errorf("type '%s' not found in package '%s'", typeName, dir)
+	}
+	if _, ok := decl.spec.Type.(*ast.StructType); !ok {
+		return nil, fmt.Errorf("type '%s' is not a structure", typeName)
+	}
+	b := &sourceSkeleton{pkg: pkg, visiting: make(map[string]bool)}
+	return renderSkeleton(b.node(ast.NewIdent(typeName)), decl.doc)
+}
+
+// typeDecl is a type declared in the package along with its doc comment.
+type typeDecl struct {
+	spec *ast.TypeSpec
+	doc  string
+}
+
+// packageDocs is information about configuration structures obtained from package sources.
+type packageDocs struct {
+	types map[string]typeDecl
+	// fields holds doc comments of structure fields keyed by "Type.Field"
+	fields map[string]string
+}
+
+// parsePackage parses all non-test Go files in directory.
+func parsePackage(dir string) (*packageDocs, error) {
+	names, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+	pkg := &packageDocs{types: make(map[string]typeDecl), fields: make(map[string]string)}
+	fset := token.NewFileSet()
+	for _, name := range names {
+		if strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		file, err := parser.ParseFile(fset, name, nil, parser.ParseComments)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse package sources: %w", err)
+		}
+		for _, decl := range file.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				ts := spec.(*ast.TypeSpec)
+				doc := ts.Doc.Text()
+				if len(doc) == 0 && len(gen.Specs) == 1 {
+					doc = gen.Doc.Text()
+				}
+				pkg.types[ts.Name.Name] = typeDecl{spec: ts, doc: strings.TrimSpace(doc)}
+				if st, ok := ts.Type.(*ast.StructType); ok {
+					for _, field := range st.Fields.List {
+						doc := field.Doc.Text()
+						if len(doc) == 0 {
+							doc = field.Comment.Text()
+						}
+						for _, fieldName := range field.Names {
+							pkg.fields[ts.Name.Name+"."+fieldName.Name] = strings.TrimSpace(doc)
+						}
+					}
+				}
+			}
+		}
+	}
+	return pkg, nil
+}
+
+// applyTags fills in field information from its struct tags.
+func (n *skeletonNode) applyTags(name, doc string, tag reflect.StructTag) {
+	n.name, n.doc = name, doc
+	n.validate = tag.Get("validate")
+	if def, ok := tag.Lookup("default"); ok {
+		n.value, n.hasDefault = def, true
+	}
+}
+
+// typeSkeleton builds skeleton from Go type information.
+type typeSkeleton struct {
+	docs     *packageDocs
+	visiting map[reflect.Type]bool
+}
+
+func (b *typeSkeleton) node(t reflect.Type) *skeletonNode {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t == durationType:
+		return &skeletonNode{value: "0s"}
+	case t == reflect.TypeFor[ByteSize]():
+		return &skeletonNode{value: "0"}
+	case reflect.PointerTo(t).Implements(textUnmarshalerType):
+		return &skeletonNode{str: true}
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if b.visiting[t] {
+			return &skeletonNode{value: "null"} // recursive structure
+		}
+		b.visiting[t] = true
+		defer delete(b.visiting, t)
+		return &skeletonNode{kind: skeletonStruct, fields: b.fields(t)}
+	case reflect.Slice, reflect.Array:
+		return &skeletonNode{kind: skeletonSequence, elem: b.node(t.Elem())}
+	case reflect.Map:
+		return &skeletonNode{kind: skeletonMapping, elem: b.node(t.Elem())}
+	case reflect.String:
+		return &skeletonNode{str: true}
+	case reflect.Bool:
+		return &skeletonNode{value: "false"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return &skeletonNode{value: "0"}
+	default:
+		return &skeletonNode{value: "null"}
+	}
+}
+
+func (b *typeSkeleton) fields(t reflect.Type) []*skeletonNode {
+	var fields []*skeletonNode
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		yf := yamlFieldOf(field)
+		if yf.skip {
+			continue
+		}
+		n := b.node(field.Type)
+		if yf.inline {
+			fields = append(fields, n.fields...)
+			continue
+		}
+		n.applyTags(yf.name, b.docs.fields[t.Name()+"."+field.Name], field.Tag)
+		fields = append(fields, n)
+	}
+	return fields
+}
+
+// sourceSkeleton builds skeleton from package sources.
+type sourceSkeleton struct {
+	pkg      *packageDocs
+	visiting map[string]bool
+}
+
+func (b *sourceSkeleton) node(expr ast.Expr) *skeletonNode {
+	switch e := expr.(type) {
+	case *ast.StarExpr:
+		return b.node(e.X)
+	case *ast.ArrayType:
+		return &skeletonNode{kind: skeletonSequence, elem: b.node(e.Elt)}
+	case *ast.MapType:
+		return &skeletonNode{kind: skeletonMapping, elem: b.node(e.Value)}
+	case *ast.StructType:
+		return &skeletonNode{kind: skeletonStruct, fields: b.fields("", e)}
+	case *ast.SelectorExpr:
+		switch e.Sel.Name {
+		case "Duration":
+			return &skeletonNode{value: "0s"}
+		case "ByteSize":
+			return &skeletonNode{value: "0"}
+		}
+		return &skeletonNode{str: true} // most likely type implementing encoding.TextUnmarshaler
+	case *ast.Ident:
+		switch e.Name {
+		case "string":
+			return &skeletonNode{str: true}
+		case "bool":
+			return &skeletonNode{value: "false"}
+		case "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64",
+			"byte", "rune", "float32", "float64":
+			return &skeletonNode{value: "0"}
+		}
+		decl, ok := b.pkg.types[e.Name]
+		if !ok {
+			return &skeletonNode{value: "null"}
+		}
+		st, ok := decl.spec.Type.(*ast.StructType)
+		if !ok {
+			return b.node(decl.spec.Type)
+		}
+		if b.visiting[e.Name] {
+			return &skeletonNode{value: "null"} // recursive structure
+		}
+		b.visiting[e.Name] = true
+		defer delete(b.visiting, e.Name)
+		return &skeletonNode{kind: skeletonStruct, fields: b.fields(e.Name, st)}
+	}
+	return &skeletonNode{value: "null"}
+}
+
+func (b *sourceSkeleton) fields(typeName string, st *ast.StructType) []*skeletonNode {
+	var fields []*skeletonNode
+	for _, field := range st.Fields.List {
+		var tag reflect.StructTag
+		if field.Tag != nil {
+			if s, err := strconv.Unquote(field.Tag.Value); err == nil {
+				tag = reflect.StructTag(s)
+			}
+		}
+		names := field.Names
+		if len(names) == 0 {
+			// embedded field, name of the field is the name of the type
+			t := field.Type
+			if star, ok := t.(*ast.StarExpr); ok {
+				t = star.X
+			}
+			switch id := t.(type) {
+			case *ast.Ident:
+				names = []*ast.Ident{id}
+			case *ast.SelectorExpr:
+				names = []*ast.Ident{id.Sel}
+			default:
+				continue
+			}
+		}
+		for _, name := range names {
+			sf := reflect.StructField{Name: name.Name, Tag: tag, Anonymous: len(field.Names) == 0}
+			if !name.IsExported() {
+				sf.PkgPath = "-" // mark field as unexported
+			}
+			yf := yamlFieldOf(sf)
+			if yf.skip {
+				continue
+			}
+			n := b.node(field.Type)
+			if yf.inline {
+				fields = append(fields, n.fields...)
+				continue
+			}
+			n.applyTags(yf.name, b.pkg.fields[typeName+"."+name.Name], tag)
+			fields = append(fields, n)
+		}
+	}
+	return fields
+}
+
+// yamlNode converts skeleton node into YAML node.
+func (n *skeletonNode) yamlNode() *yaml.Node {
+	switch {
+	case n.kind == skeletonStruct:
+		node := &yaml.Node{Kind: yaml.MappingNode}
+		for _, field := range n.fields {
+			key := &yaml.Node{Kind: yaml.ScalarNode, Value: field.name}
+			var comments []string
+			if len(field.doc) > 0 {
+				comments = append(comments, field.doc)
+			}
+			if len(field.validate) > 0 {
+				comments = append(comments, "validate: "+field.validate)
+			}
+			key.HeadComment = strings.Join(comments, "\n")
+			node.Content = append(node.Content, key, field.yamlNode())
+		}
+		return node
+	case n.hasDefault && n.kind == skeletonSequence:
+		// defaults for collections are comma separated lists
+		node := &yaml.Node{Kind: yaml.SequenceNode, Style: yaml.FlowStyle}
+		for _, item := range strings.Split(n.value, ",") {
+			node.Content = append(node.Content, (&skeletonNode{value: strings.TrimSpace(item), str: n.elem.str}).yamlNode())
+		}
+		return node
+	case n.hasDefault && n.kind == skeletonMapping:
+		// ... of key=value pairs for maps
+		node := &yaml.Node{Kind: yaml.MappingNode, Style: yaml.FlowStyle}
+		for _, item := range strings.Split(n.value, ",") {
+			k, v, _ := strings.Cut(item, "=")
+			node.Content = append(node.Content,
+				&yaml.Node{Kind: yaml.ScalarNode, Value: strings.TrimSpace(k)},
+				(&skeletonNode{value: strings.TrimSpace(v), str: n.elem.str}).yamlNode())
+		}
+		return node
+	case n.kind == skeletonSequence:
+		node := &yaml.Node{Kind: yaml.SequenceNode, Style: yaml.FlowStyle}
+		if n.elem.kind == skeletonStruct {
+			// show structure of elements with example element
+			node.Style = 0
+			node.Content = []*yaml.Node{n.elem.yamlNode()}
+		}
+		return node
+	case n.kind == skeletonMapping:
+		node := &yaml.Node{Kind: yaml.MappingNode, Style: yaml.FlowStyle}
+		if n.elem.kind == skeletonStruct {
+			// show structure of values with example entry
+			node.Style = 0
+			node.Content = []*yaml.Node{{Kind: yaml.ScalarNode, Value: "name"}, n.elem.yamlNode()}
+		}
+		return node
+	}
+
+	node := &yaml.Node{Kind: yaml.ScalarNode, Value: n.value}
+	if possiblyTemplate.MatchString(n.value) {
+		node.Style = yaml.SingleQuotedStyle
+	} else if n.str {
+		node.Tag = "!!str"
+	}
+	return node
+}
+
+// renderSkeleton renders skeleton as YAML document with optional header comment.
+func renderSkeleton(root *skeletonNode, doc string) ([]byte, error) {
+	tree := &yaml.Node{Kind: yaml.DocumentNode, HeadComment: doc, Content: []*yaml.Node{root.yamlNode()}}
+	buf := new(bytes.Buffer)
+	enc := yaml.NewEncoder(buf)
+	enc.SetIndent(4)
+	if err := enc.Encode(tree); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,99 @@
+package gencfg
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const skeletonSource = `package config
+
+import "time"
+
+// SkeletonConfig is the service configuration.
+type SkeletonConfig struct {
+	// Name of the service.
+	Name    string        ` + "`yaml:\"name\" validate:\"required\"`" + `
+	DataDir string        ` + "`yaml:\"data_dir\" default:\"{{ joinPath .ProjectDir \\\"data\\\" }}\"`" + `
+	Timeout time.Duration ` + "`yaml:\"timeout\" default:\"30s\"`" + ` // request timeout
+	Debug   bool          ` + "`yaml:\"debug\"`" + `
+	Hosts   []string      ` + "`yaml:\"hosts\" default:\"a,b\"`" + `
+	DB      SkeletonDB    ` + "`yaml:\"db\"`" + `
+	Shards  []SkeletonDB  ` + "`yaml:\"shards\"`" + `
+	Labels  map[string]string ` + "`yaml:\"labels\"`" + `
+	Ignored string        ` + "`yaml:\"-\"`" + `
+	hidden  string
+}
+
+// SkeletonDB is database configuration.
+type SkeletonDB struct {
+	// Port to connect to.
+	Port int ` + "`yaml:\"port\" default:\"5432\" validate:\"gt=0\"`" + `
+}
+`
+
+// SkeletonConfig is the service configuration.
+type SkeletonConfig struct {
+	// Name of the service.
+	Name    string            `yaml:"name" validate:"required"`
+	DataDir string            `yaml:"data_dir" default:"{{ joinPath .ProjectDir \"data\" }}"`
+	Timeout time.Duration     `yaml:"timeout" default:"30s"` // request timeout
+	Debug   bool              `yaml:"debug"`
+	Hosts   []string          `yaml:"hosts" default:"a,b"`
+	DB      SkeletonDB        `yaml:"db"`
+	Shards  []SkeletonDB      `yaml:"shards"`
+	Labels  map[string]string `yaml:"labels"`
+	Ignored string            `yaml:"-"`
+	hidden  string
+}
+
+// SkeletonDB is database configuration.
+type SkeletonDB struct {
+	// Port to connect to.
+	Port int `yaml:"port" default:"5432" validate:"gt=0"`
+}
+
+const skeletonExpected = `# SkeletonConfig is the service configuration.
+
+# Name of the service.
+# validate: required
+name: ""
+data_dir: '{{ joinPath .ProjectDir "data" }}'
+# request timeout
+timeout: 30s
+debug: false
+hosts: [a, b]
+db:
+    # Port to connect to.
+    # validate: gt=0
+    port: 5432
+shards:
+    - # Port to connect to.
+      # validate: gt=0
+      port: 5432
+labels: {}
+`
+
+func TestSkeleton(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "config.go"), []byte(skeletonSource), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Skeleton(&SkeletonConfig{hidden: "x"}, WithPackageDir(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != skeletonExpected {
+		t.Fatalf("got:\n%s\nwant:\n%s", got, skeletonExpected)
+	}
+
+	got, err = SkeletonFromPackage(dir, "SkeletonConfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != skeletonExpected {
+		t.Fatalf("got:\n%s\nwant:\n%s", got, skeletonExpected)
+	}
+}
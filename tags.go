@@ -0,0 +1,203 @@
+package gencfg
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// TagContext is passed to TagHandler.
+type TagContext struct {
+	// Name of the field tagged value is assigned to
+	Name string
+	// Tag being resolved, for example "!env"
+	Tag string
+	// KeepString could be set by handler to keep result as a string rather than
+	// interpreting it as YAML fragment
+	KeepString bool
+	// KeepScalar could be set by handler to keep result as a single scalar, only its type
+	// (string, int, float, bool or null) is resolved the same way as for plain YAML scalars
+	KeepScalar bool
+
+	opts *ProcessingOptions
+	each *eachItem
+}
+
+// Expand expands template with the same variables and functions as values of the configuration template.
+func (ctx *TagContext) Expand(field string) (string, error) {
+	return (&expansion{opts: ctx.opts}).expand(ctx.Name, field, ctx.each)
+}
+
+// ProjectDir returns project directory relative paths are resolved against.
+func (ctx *TagContext) ProjectDir() string {
+	return ctx.opts.rootDir
+}
+
+// Argument returns value of the argument passed with WithArgument.
+func (ctx *TagContext) Argument(name string) (string, bool) {
+	value, ok := ctx.opts.args[name]
+	return value, ok
+}
+
+// ReadFile reads file, relative names are resolved against project directory or file system set with WithFS.
+func (ctx *TagContext) ReadFile(name string) ([]byte, error) {
+	_, data, err := ctx.opts.readFile(name)
+	return data, err
+}
+
+// Params returns parameters of the tagged node: value of the scalar or values of the sequence of scalars,
+// so both "!tag value" and "!tag [value, default]" forms are supported.
+func (ctx *TagContext) Params(node *yaml.Node) ([]string, error) {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		return []string{node.Value}, nil
+	case yaml.SequenceNode:
+		params := make([]string, 0, len(node.Content))
+		for _, item := range node.Content {
+			if item.Kind != yaml.ScalarNode {
+				return nil, fmt.Errorf("%s parameters must be scalars", ctx.Tag)
+			}
+			params = append(params, item.Value)
+		}
+		return params, nil
+	}
+	return nil, fmt.Errorf("%s expects scalar or sequence of scalars", ctx.Tag)
+}
+
+// TagHandler resolves value of the node with custom YAML tag. Result replaces the node and is
+// interpreted as YAML fragment, the same way as expanded templates, unless ctx.KeepString or
+// ctx.KeepScalar is set.
+type TagHandler func(ctx *TagContext, node *yaml.Node) (string, error)
+
+// WithTagHandler adds handler for custom YAML tag available to a single Process call only.
+// It takes precedence over registered handlers for the same tag.
+func WithTagHandler(tag string, handler TagHandler) func(*ProcessingOptions) {
+	return func(opts *ProcessingOptions) {
+		if opts.tagHandlers == nil {
+			opts.tagHandlers = make(map[string]TagHandler)
+		}
+		opts.tagHandlers[tag] = handler
+	}
+}
+
+// lookupTag finds handler for custom tag, per call handlers are checked first.
+func (opts *ProcessingOptions) lookupTag(tag string) TagHandler {
+	if handler, ok := opts.tagHandlers[tag]; ok {
+		return handler
+	}
+	tagRegistryGuard.RLock()
+	defer tagRegistryGuard.RUnlock()
+	return tagRegistry[tag]
+}
+
+// tagRegistry keeps all globally available tag handlers, built-in ones included.
+var (
+	tagRegistryGuard sync.RWMutex
+	tagRegistry      = map[string]TagHandler{
+		"!env":        tagEnv,
+		"!arg":        tagArg,
+		"!file":       tagFile,
+		"!base64file": tagBase64File,
+		"!str":        tagStr,
+	}
+)
+
+// RegisterTagHandler makes handler for custom YAML tag (including leading "!") available to
+// all subsequent Process calls. Registering handler for an existing tag replaces it.
+func RegisterTagHandler(tag string, handler TagHandler) {
+	if !strings.HasPrefix(tag, "!") || len(tag) < 2 || handler == nil {
+		panic("gencfg: RegisterTagHandler requires tag starting with '!' and handler")
+	}
+	tagRegistryGuard.Lock()
+	defer tagRegistryGuard.Unlock()
+	tagRegistry[tag] = handler
+}
+
+// nameWithDefault is a helper for "!tag name" and "!tag [name, default]" forms.
+func nameWithDefault(ctx *TagContext, node *yaml.Node) (string, *string, error) {
+	params, err := ctx.Params(node)
+	if err != nil {
+		return "", nil, err
+	}
+	switch len(params) {
+	case 1:
+		return params[0], nil, nil
+	case 2:
+		return params[0], &params[1], nil
+	}
+	return "", nil, fmt.Errorf("%s expects name and optional default value", ctx.Tag)
+}
+
+// tagEnv - "!env NAME" or "!env [NAME, default]", value of environment variable.
+func tagEnv(ctx *TagContext, node *yaml.Node) (string, error) {
+	name, def, err := nameWithDefault(ctx, node)
+	if err != nil {
+		return "", err
+	}
+	ctx.KeepScalar = true
+	if value, ok := os.LookupEnv(name); ok {
+		return value, nil
+	}
+	if def != nil {
+		return *def, nil
+	}
+	return "", fmt.Errorf("environment variable '%s' is not set", name)
+}
+
+// tagArg - "!arg name" or "!arg [name, default]", value of argument passed with WithArgument.
+func tagArg(ctx *TagContext, node *yaml.Node) (string, error) {
+	name, def, err := nameWithDefault(ctx, node)
+	if err != nil {
+		return "", err
+	}
+	ctx.KeepScalar = true
+	if value, ok := ctx.Argument(name); ok {
+		return value, nil
+	}
+	if def != nil {
+		return *def, nil
+	}
+	return "", fmt.Errorf("argument '%s' is not set", name)
+}
+
+// tagFile - "!file path", content of the file without trailing new line, always a string.
+func tagFile(ctx *TagContext, node *yaml.Node) (string, error) {
+	if node.Kind != yaml.ScalarNode {
+		return "", fmt.Errorf("%s expects file name", ctx.Tag)
+	}
+	data, err := ctx.ReadFile(node.Value)
+	if err != nil {
+		return "", err
+	}
+	ctx.KeepString = true
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// tagBase64File - "!base64file path", base64 encoded content of the file.
+func tagBase64File(ctx *TagContext, node *yaml.Node) (string, error) {
+	if node.Kind != yaml.ScalarNode {
+		return "", fmt.Errorf("%s expects file name", ctx.Tag)
+	}
+	data, err := ctx.ReadFile(node.Value)
+	if err != nil {
+		return "", err
+	}
+	ctx.KeepString = true
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+// tagStr - "!str value", value (could be a template) which is always kept as a string.
+func tagStr(ctx *TagContext, node *yaml.Node) (string, error) {
+	if node.Kind != yaml.ScalarNode {
+		return "", fmt.Errorf("%s expects scalar", ctx.Tag)
+	}
+	ctx.KeepString = true
+	if !possiblyTemplate.MatchString(node.Value) || ctx.opts.doNotExpand[ctx.Name] {
+		return node.Value, nil
+	}
+	return ctx.Expand(node.Value)
+}
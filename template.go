@@ -18,11 +18,16 @@ type Values struct {
 	Arguments     map[string]string
 	Hostname      string
 	IPv4          string
+	IPv6          string
+	Interfaces    map[string][]string
 	Containerized bool
 	Testing       bool
 	CPUs          int
 	ARCH          string
 	OS            string
+	// Item and Index are set for the current item when subtree is replicated with !each
+	Item  any
+	Index int
 }
 
 // expandField expands a field using the given name and field string, for example
@@ -36,17 +41,88 @@ type Values struct {
 //
 // In this case name will be "sources" and result will be "sources-http"
 func expandField(name, field string, opts *ProcessingOptions) (string, error) {
+	return (&expansion{opts: opts}).expand(name, field, nil)
+}
+
+// eachItem is the current item of the subtree replicated with !each.
+type eachItem struct {
+	value any
+	index int
+}
+
+// expansion keeps state of a single field expansion shared by template functions.
+type expansion struct {
+	opts *ProcessingOptions
+	// stack is the chain of partials being included, to detect include cycles
+	stack []string
+	// structured is set when template explicitly emitted structured data
+	structured bool
+}
+
+// expand expands a field, item is set inside of the subtree replicated with !each.
+func (exp *expansion) expand(name, field string, item *eachItem) (string, error) {
 
+	tmpl, err := template.New(name).Funcs(newFuncMap(exp)).Parse(field)
+	if err != nil {
+		return "", err
+	}
+
+	values, err := newValues(name, exp.opts)
+	if err != nil {
+		return "", err
+	}
+	if item != nil {
+		values.Item, values.Index = item.value, item.index
+	}
+
+	buf := new(bytes.Buffer)
+	if err := tmpl.Execute(buf, values); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// newFuncMap returns functions available for template expansion.
+func newFuncMap(exp *expansion) template.FuncMap {
 	// Make avalable functions from slim-sprig package: https://go-task.github.io/slim-sprig/
 	funcMap := sprig.FuncMap()
+	// Functions producing structured data mark the expansion
+	for _, name := range []string{"toJson", "toPrettyJson", "toRawJson"} {
+		fn := funcMap[name].(func(any) string)
+		funcMap[name] = func(v any) string {
+			exp.structured = true
+			return fn(v)
+		}
+	}
+	for _, name := range []string{"mustToJson", "mustToPrettyJson", "mustToRawJson"} {
+		fn := funcMap[name].(func(any) (string, error))
+		funcMap[name] = func(v any) (string, error) {
+			exp.structured = true
+			return fn(v)
+		}
+	}
 	// Add our functions
 	funcMap["joinPath"] = joinPath
 	funcMap["freeLocalPort"] = freeLocalPort
+	funcMap["freePort"] = freePort
+	funcMap["freePortInRange"] = freePortInRange
+	funcMap["freePorts"] = freePorts
+	funcMap["include"] = exp.include
+	funcMap["toYaml"] = exp.toYaml
+	funcMap["fromYaml"] = fromYaml
+	funcMap["readFile"] = exp.readFile
+	funcMap["readYaml"] = exp.readYaml
+	funcMap["glob"] = exp.glob
+	funcMap["interfaceAddr"] = interfaceAddr
+	funcMap["primaryIP"] = primaryIP
+	funcMap["cidrHost"] = cidrHost
+	funcMap["lookupHost"] = exp.lookupHost
+	return funcMap
+}
 
-	tmpl, err := template.New(name).Funcs(funcMap).Parse(field)
-	if err != nil {
-		return "", err
-	}
+// newValues returns variables available for template expansion of the named node.
+func newValues(name string, opts *ProcessingOptions) (Values, error) {
+	var err error
 
 	values := Values{
 		Name:       name,
@@ -58,33 +134,40 @@ func expandField(name, field string, opts *ProcessingOptions) (string, error) {
 		OS:         runtime.GOOS,
 	}
 	if values.Hostname, err = os.Hostname(); err != nil {
-		return "", err
+		return values, err
 	}
-	if values.IPv4, err = getIPv4(values.Hostname); err != nil {
-		return "", err
+	if values.IPv4, values.IPv6, err = getHostIPs(values.Hostname); err != nil && !opts.lenientDNS {
+		return values, err
+	}
+	if values.Interfaces, err = getInterfaces(); err != nil {
+		return values, err
 	}
 	if _, err = os.Stat("/.dockerenv"); err == nil {
 		values.Containerized = true
 	} else if _, err = os.Stat("/.containerenv"); err == nil {
 		values.Containerized = true
 	}
-
-	buf := new(bytes.Buffer)
-	if err := tmpl.Execute(buf, values); err != nil {
-		return "", err
-	}
-	return buf.String(), nil
+	return values, nil
 }
 
-func getIPv4(host string) (string, error) {
+// getHostIPs returns the first non loopback IPv4 and IPv6 addresses of the host.
+func getHostIPs(host string) (string, string, error) {
 	addrs, err := net.LookupIP(host)
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
+	var ipv4, ipv6 string
 	for _, addr := range addrs {
-		if ipv4 := addr.To4(); ipv4 != nil {
-			return ipv4.String(), nil
+		if addr.IsLoopback() {
+			continue
+		}
+		if v4 := addr.To4(); v4 != nil {
+			if len(ipv4) == 0 {
+				ipv4 = v4.String()
+			}
+		} else if len(ipv6) == 0 {
+			ipv6 = addr.String()
 		}
 	}
-	return "", nil
+	return ipv4, ipv6, nil
 }
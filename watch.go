@@ -0,0 +1,270 @@
+package gencfg
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
+)
+
+// WatchOptions holds options for configuration Watcher.
+type WatchOptions struct {
+	load     []func(*LoadOptions)
+	interval time.Duration
+	onError  func(error)
+}
+
+// WithLoadOptions sets options used to load configuration, configuration files to watch are
+// specified here with WithConfigFile.
+func WithLoadOptions(options ...func(*LoadOptions)) func(*WatchOptions) {
+	return func(opts *WatchOptions) {
+		opts.load = append(opts.load, options...)
+	}
+}
+
+// WithInterval sets how often configuration files are checked for changes, default is 1 second.
+func WithInterval(interval time.Duration) func(*WatchOptions) {
+	return func(opts *WatchOptions) {
+		if interval > 0 {
+			opts.interval = interval
+		}
+	}
+}
+
+// WithErrorHandler sets function which is called when configuration could not be reloaded,
+// the last good configuration is kept in this case.
+func WithErrorHandler(handler func(error)) func(*WatchOptions) {
+	return func(opts *WatchOptions) {
+		opts.onError = handler
+	}
+}
+
+// Update is published to Watcher subscribers when configuration changes.
+type Update[T any] struct {
+	// Config is the new configuration snapshot, it should not be modified by subscribers
+	Config *T
+	// Changed lists paths of the fields which values have changed, for example "DB.User" or `Shards["eu"]`
+	Changed []string
+}
+
+// fileStamp is used to detect changes of configuration files.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+	exists  bool
+}
+
+// Watcher monitors configuration files and reloads configuration when they change. New configuration
+// is published to subscribers only when the whole loading pipeline, including validation, succeeds.
+type Watcher[T any] struct {
+	tmpl  []byte
+	opts  *WatchOptions
+	files []string
+	fsys  fs.FS
+
+	reload  sync.Mutex // serializes reloads, so older configuration never replaces newer one
+	mu      sync.Mutex
+	current *T
+	read    []string // files read by the template
+	stamps  []fileStamp
+	subs    []func(Update[T])
+}
+
+// NewWatcher loads initial configuration from template and configuration files and returns
+// watcher for them and for files read by the template (partials, data files). Call Run to start monitoring.
+func NewWatcher[T any](tmpl []byte, options ...func(*WatchOptions)) (*Watcher[T], error) {
+	opts := &WatchOptions{interval: time.Second}
+	for _, setOpt := range options {
+		setOpt(opts)
+	}
+	lopts := &LoadOptions{}
+	for _, setOpt := range opts.load {
+		setOpt(lopts)
+	}
+
+	popts, err := newProcessingOptions(lopts.process)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &Watcher[T]{tmpl: tmpl, opts: opts, files: lopts.files, fsys: popts.fsys}
+	// files read by the template are not known yet, they are stamped on the first check
+	stamps := w.stat(nil)
+	cfg, read, err := w.load()
+	if err != nil {
+		return nil, err
+	}
+	w.current, w.read, w.stamps = cfg, read, stamps
+	return w, nil
+}
+
+// Config returns the last good configuration snapshot.
+func (w *Watcher[T]) Config() *T {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.current
+}
+
+// Subscribe registers function to be called with every configuration update.
+// Subscribers are called synchronously from the reloading goroutine.
+func (w *Watcher[T]) Subscribe(fn func(Update[T])) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.subs = append(w.subs, fn)
+}
+
+// Updates returns channel which receives configuration updates. Channel is buffered with
+// specified size, updates are dropped when it is full.
+func (w *Watcher[T]) Updates(size int) <-chan Update[T] {
+	ch := make(chan Update[T], size)
+	w.Subscribe(func(u Update[T]) {
+		select {
+		case ch <- u:
+		default:
+		}
+	})
+	return ch
+}
+
+// Run checks configuration files for changes until context is canceled, it always returns context error.
+func (w *Watcher[T]) Run(ctx context.Context) error {
+	ticker := time.NewTicker(w.opts.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			w.mu.Lock()
+			stamps := w.stat(w.read)
+			changed := !slices.Equal(stamps, w.stamps)
+			w.stamps = stamps
+			w.mu.Unlock()
+			if changed {
+				if err := w.Reload(); err != nil && w.opts.onError != nil {
+					w.opts.onError(err)
+				}
+			}
+		}
+	}
+}
+
+// Reload unconditionally runs loading pipeline (on SIGHUP for example) and publishes new
+// configuration if it is valid and differs from the current one. On error current configuration is kept.
+// Concurrent calls are serialized.
+func (w *Watcher[T]) Reload() error {
+	w.reload.Lock()
+	defer w.reload.Unlock()
+
+	// files are stamped before loading, so changes made while loading are noticed on the next check
+	w.mu.Lock()
+	stamps := w.stat(w.read)
+	w.mu.Unlock()
+
+	cfg, read, err := w.load()
+	if err != nil {
+		return fmt.Errorf("unable to reload configuration: %w", err)
+	}
+
+	w.mu.Lock()
+	// template may read different files now, in which case stamps do not match and the next check reloads again
+	w.read, w.stamps = read, stamps
+	var changed []string
+	changedPaths(reflect.ValueOf(w.current).Elem(), reflect.ValueOf(cfg).Elem(), "", &changed)
+	if len(changed) == 0 {
+		w.mu.Unlock()
+		return nil
+	}
+	slices.Sort(changed)
+	w.current = cfg
+	subs := slices.Clone(w.subs)
+	w.mu.Unlock()
+
+	for _, fn := range subs {
+		fn(Update[T]{Config: cfg, Changed: changed})
+	}
+	return nil
+}
+
+// load runs loading pipeline and returns configuration and files read by the template.
+func (w *Watcher[T]) load() (*T, []string, error) {
+	var read []string
+	options := append(slices.Clone(w.opts.load), WithProcessingOptions(WithReadFiles(&read)))
+	cfg := new(T)
+	if err := Load(w.tmpl, cfg, options...); err != nil {
+		return nil, nil, err
+	}
+	return cfg, read, nil
+}
+
+// stat returns stamps of configuration files and files read by the template.
+func (w *Watcher[T]) stat(read []string) []fileStamp {
+	files := append(slices.Clone(w.files), read...)
+	stamps := make([]fileStamp, len(files))
+	for i, name := range files {
+		var info fs.FileInfo
+		var err error
+		if w.fsys != nil && !filepath.IsAbs(name) {
+			info, err = fs.Stat(w.fsys, path.Clean(filepath.ToSlash(name)))
+		} else {
+			info, err = os.Stat(name)
+		}
+		if err == nil {
+			stamps[i] = fileStamp{modTime: info.ModTime(), size: info.Size(), exists: true}
+		}
+	}
+	return stamps
+}
+
+// changedPaths collects paths of the values which differ. Structures and maps are compared
+// field by field and key by key, everything else is compared as a whole.
+func changedPaths(a, b reflect.Value, path string, changed *[]string) {
+	switch a.Kind() {
+	case reflect.Struct:
+		for i := 0; i < a.NumField(); i++ {
+			field := a.Type().Field(i)
+			if !field.IsExported() && !(field.Anonymous && field.Type.Kind() == reflect.Struct) {
+				continue
+			}
+			fpath := path
+			if !field.Anonymous {
+				fpath = fieldPath(path, field.Name)
+			}
+			changedPaths(a.Field(i), b.Field(i), fpath, changed)
+		}
+		return
+	case reflect.Pointer:
+		if !a.IsNil() && !b.IsNil() && a.Elem().Kind() == reflect.Struct {
+			changedPaths(a.Elem(), b.Elem(), path, changed)
+			return
+		}
+	case reflect.Map:
+		if !a.IsNil() && !b.IsNil() {
+			keys := a.MapKeys()
+			for _, key := range b.MapKeys() {
+				if !a.MapIndex(key).IsValid() {
+					keys = append(keys, key)
+				}
+			}
+			for _, key := range keys {
+				kpath := keyPath(path, key)
+				av, bv := a.MapIndex(key), b.MapIndex(key)
+				if !av.IsValid() || !bv.IsValid() {
+					*changed = append(*changed, kpath)
+					continue
+				}
+				changedPaths(av, bv, kpath, changed)
+			}
+			return
+		}
+	}
+	if a.CanInterface() && !reflect.DeepEqual(a.Interface(), b.Interface()) {
+		*changed = append(*changed, path)
+	}
+}
@@ -0,0 +1,220 @@
+package gencfg
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWatcher(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.yaml")
+	write := func(content string, stamp time.Time) {
+		t.Helper()
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		// make sure change is noticed on file systems with coarse timestamps
+		if err := os.Chtimes(file, stamp, stamp); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Now()
+	write("db:\n  user: first\nshards:\n  eu:\n    port: 1\n", now)
+
+	errs := make(chan error, 1)
+	name := filepath.Join(dir, "name.txt")
+	if err := os.WriteFile(name, []byte("test"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w, err := NewWatcher[loadConfig]([]byte(`name: '{{ readFile "name.txt" }}'`),
+		WithInterval(5*time.Millisecond),
+		WithErrorHandler(func(err error) { errs <- err }),
+		WithLoadOptions(WithConfigFile(file), WithProcessingOptions(WithRootDir(dir), WithArgument("suffix", "x"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.Config().DB.User != "first" || w.Config().Name != "test" {
+		t.Fatalf("unexpected initial configuration: %+v", w.Config())
+	}
+	updates := w.Updates(1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = w.Run(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	next := func() Update[loadConfig] {
+		t.Helper()
+		select {
+		case u := <-updates:
+			return u
+		case <-time.After(5 * time.Second):
+			t.Fatal("no configuration update")
+		}
+		return Update[loadConfig]{}
+	}
+
+	write("db:\n  user: second\nshards:\n  eu:\n    port: 2\n  us:\n    port: 3\n", now.Add(time.Second))
+	u := next()
+	if u.Config.DB.User != "second" || w.Config() != u.Config {
+		t.Fatalf("unexpected update: %+v", u.Config)
+	}
+	if expected := []string{"DB.User", `Shards["eu"].Port`, `Shards["us"]`}; !slices.Equal(u.Changed, expected) {
+		t.Fatalf("unexpected changed paths: %v", u.Changed)
+	}
+
+	// invalid configuration is not published and the last good one is kept
+	good := w.Config()
+	write("db:\n  unknown: 1\n", now.Add(2*time.Second))
+	select {
+	case err := <-errs:
+		if !strings.Contains(err.Error(), "unable to reload configuration") {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no reload error")
+	}
+	if w.Config() != good {
+		t.Fatal("invalid configuration replaced the last good one")
+	}
+
+	write("db:\n  user: third\n", now.Add(3*time.Second))
+	if u := next(); u.Config.DB.User != "third" {
+		t.Fatalf("unexpected update: %+v", u.Config)
+	}
+
+	// files read by the template are watched too
+	if err := os.WriteFile(name, []byte("renamed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(name, now.Add(4*time.Second), now.Add(4*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if u := next(); u.Config.Name != "renamed" || !slices.Equal(u.Changed, []string{"Name"}) {
+		t.Fatalf("unexpected update: %+v %v", u.Config, u.Changed)
+	}
+}
+
+func TestWatcherWriteDuringLoad(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.yaml")
+	now := time.Now()
+	write := func(content string, stamp time.Time) {
+		t.Helper()
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(file, stamp, stamp); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("user: first\n", now)
+
+	type config struct {
+		User string `yaml:"user" sanitize:"hook"`
+	}
+	// configuration file is changed after it was read, while initial configuration is still being loaded
+	var once sync.Once
+	hook := func(_ SanitizeContext, _ reflect.Value, _ string) error {
+		once.Do(func() { write("user: second\n", now.Add(time.Second)) })
+		return nil
+	}
+	w, err := NewWatcher[config](nil,
+		WithInterval(5*time.Millisecond),
+		WithLoadOptions(WithConfigFile(file), WithSanitizeOptions(WithSanitizer("hook", hook))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.Config().User != "first" {
+		t.Fatalf("unexpected initial configuration: %+v", w.Config())
+	}
+	updates := w.Updates(1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = w.Run(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	select {
+	case u := <-updates:
+		if u.Config.User != "second" {
+			t.Fatalf("unexpected update: %+v", u.Config)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("change made during load was missed")
+	}
+}
+
+func TestWatcherConcurrentReload(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(file, []byte("user: old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	type config struct {
+		User string `yaml:"user" sanitize:"hook"`
+	}
+	// the first reload is held after reading old configuration
+	var (
+		hold     atomic.Bool
+		started  = make(chan struct{})
+		released = make(chan struct{})
+	)
+	hook := func(_ SanitizeContext, v reflect.Value, _ string) error {
+		if v.String() == "old" && hold.CompareAndSwap(true, false) {
+			close(started)
+			<-released
+		}
+		return nil
+	}
+	w, err := NewWatcher[config](nil, WithLoadOptions(WithConfigFile(file), WithSanitizeOptions(WithSanitizer("hook", hook))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hold.Store(true)
+	first := make(chan error, 1)
+	go func() { first <- w.Reload() }()
+	<-started
+
+	if err := os.WriteFile(file, []byte("user: new\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	second := make(chan error, 1)
+	go func() { second <- w.Reload() }()
+	select {
+	case err := <-second:
+		t.Fatalf("second reload was not serialized: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(released)
+
+	for _, ch := range []chan error{first, second} {
+		if err := <-ch; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if w.Config().User != "new" {
+		t.Fatalf("older configuration replaced newer one: %+v", w.Config())
+	}
+}